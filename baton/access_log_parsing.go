@@ -0,0 +1,146 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// combinedLogPattern matches the nginx/Apache combined log format, as well as the common log format
+const combinedLogPattern = `^(?P<host>\S+) \S+ \S+ \[(?P<time>[^\]]+)\] "(?P<request>[^"]*)" (?P<status>\d{3}) \S+(?: "(?P<referer>[^"]*)" "(?P<agent>[^"]*)")?`
+
+const combinedLogTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// parseLogTime parses the time of a log line, either as written by nginx/Apache, as RFC 3339 or as seconds since the epoch
+func parseLogTime(value string) (time.Time, error) {
+	if parsed, err := time.Parse(combinedLogTimeLayout, value); err == nil {
+		return parsed, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return parsed, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return time.Time{}, errors.New("unrecognised time: " + value)
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), nil
+}
+
+type accessLogLine struct {
+	time    time.Time
+	request preLoadedRequest
+}
+
+func preLoadRequestsFromAccessLogFile(filename string, target string, pattern string) ([]preLoadedRequest, error) {
+	if target == "" {
+		return nil, errors.New("a target to replay the access log against is required")
+	}
+	if pattern == "" {
+		pattern = combinedLogPattern
+	}
+	expression, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string]int{}
+	for i, name := range expression.SubexpNames() {
+		if name != "" {
+			groups[name] = i
+		}
+	}
+	_, hasRequest := groups["request"]
+	_, hasPath := groups["path"]
+	if _, hasTime := groups["time"]; !hasTime || (!hasRequest && !hasPath) {
+		return nil, errors.New("the log pattern needs a time group and either a request or a path group")
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	target = strings.TrimSuffix(target, "/")
+	var lines []accessLogLine
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		match := expression.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		group := func(name string) string {
+			if index, ok := groups[name]; ok {
+				return match[index]
+			}
+			return ""
+		}
+
+		method, path := group("method"), group("path")
+		if hasRequest {
+			// The request line looks like "GET /path?query HTTP/1.1"
+			requestLine := strings.Fields(group("request"))
+			if len(requestLine) < 2 {
+				continue
+			}
+			method, path = requestLine[0], requestLine[1]
+		}
+		if method == "" {
+			method = "GET"
+		}
+		if method != "GET" && method != "HEAD" {
+			continue
+		}
+		if !strings.HasPrefix(path, "/") {
+			continue
+		}
+
+		requestTime, err := parseLogTime(group("time"))
+		if err != nil {
+			return nil, err
+		}
+
+		var headers [][]string
+		if agent := group("agent"); agent != "" && agent != "-" {
+			headers = append(headers, []string{"User-Agent", agent})
+		}
+		lines = append(lines, accessLogLine{requestTime, preLoadedRequest{method: method, url: target + path, headers: headers, weight: 1}})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].time.Before(lines[j].time)
+	})
+
+	requests := make([]preLoadedRequest, len(lines))
+	for i, line := range lines {
+		requests[i] = line.request
+		requests[i].offset = line.time.Sub(lines[0].time)
+	}
+	return requests, nil
+}
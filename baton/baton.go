@@ -0,0 +1,503 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/valyala/fasthttp"
+	"io/ioutil"
+	"log"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Baton implements the load tester
+type Baton struct {
+	configuration Configuration
+	result        Result
+	logger        *log.Logger
+}
+
+type preLoadedRequest struct {
+	method   string               // The HTTP method used to send the request
+	url      string               // The URL to send the request at
+	body     string               // The body of the request (if appropriate method is selected)
+	headers  [][]string           // Array of two-element key/value pairs of header and value
+	weight   int                  // The relative frequency with which the request is picked
+	name     string               // An optional name used to identify the request in the results
+	group    string               // An optional group, such as a folder, the request is reported under
+	expect   *responseExpectation // What the response should look like (optional)
+	offset   time.Duration        // When the request was recorded, relative to the first request in the file
+	template *requestTemplate     // The parsed template expressions of the request (nil if there are none)
+}
+
+type runConfiguration struct {
+	preLoadedRequestsMode bool
+	timedMode             bool
+	preLoadedRequests     []preLoadedRequest
+	requestSelectors      []requestSelector
+	dataFeeders           []*dataFeeder
+	request               preLoadedRequest
+	scenario              *scenario
+	script                *script
+	pacing                pacing
+	transports            []Transport // The transport of each virtual user
+	connectionsOpened     *uint64
+	requests              chan bool
+	results               chan HTTPResult
+	done                  chan bool
+	body                  string
+}
+
+// run sends the requests, stopping early when the context is cancelled
+func (baton *Baton) run(ctx context.Context) error {
+
+	baton.logger = newLogger(baton.configuration.suppressOutput)
+
+	err := baton.configuration.useUnixURL()
+	if err == nil {
+		err = baton.configuration.validate()
+	}
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	preparedRunConfiguration, err := prepareRun(ctx, baton.configuration, baton.logger)
+	if err != nil {
+		return fmt.Errorf("error during run preparation: %v", err)
+	}
+
+	if baton.configuration.wait > 0 {
+		select {
+		case <-time.After(baton.configuration.wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	baton.logger.Println("Sending the requests to the server...")
+
+	// Start the timer and kick off the workers
+	start := time.Now()
+	for w := 1; w <= baton.configuration.concurrency; w++ {
+		var worker workable
+		if preparedRunConfiguration.timedMode {
+			worker = newTimedWorker(ctx, w, preparedRunConfiguration.requests, preparedRunConfiguration.results, preparedRunConfiguration.done, baton.configuration.duration)
+		} else {
+			worker = newCountWorker(ctx, w, preparedRunConfiguration.requests, preparedRunConfiguration.results, preparedRunConfiguration.done)
+		}
+		worker.setConnLimit(baton.configuration.connLimit())
+		worker.setTransport(preparedRunConfiguration.transports[w-1])
+		worker.setVirtualUser(newVirtualUser(w, baton.configuration.keepCookies))
+		worker.setPacing(preparedRunConfiguration.pacing)
+		worker.setHooks(baton.configuration.hooks)
+		worker.setTimeout(baton.configuration.timeout)
+		if preparedRunConfiguration.script != nil {
+			worker.setScript(newScriptRunner(preparedRunConfiguration.script, w))
+		}
+		worker.setDataFeeders(preparedRunConfiguration.dataFeeders)
+		if preparedRunConfiguration.scenario != nil {
+			go worker.sendScenario(preparedRunConfiguration.scenario)
+		} else if preparedRunConfiguration.preLoadedRequestsMode {
+			go worker.sendRequests(preparedRunConfiguration.preLoadedRequests, preparedRunConfiguration.requestSelectors[w-1])
+		} else {
+			go worker.sendRequest(preparedRunConfiguration.request)
+		}
+	}
+
+	// Wait for all the workers to finish and then stop the timer
+	for a := 1; a <= baton.configuration.concurrency; a++ {
+		<-preparedRunConfiguration.done
+	}
+	baton.result.timeTaken = time.Since(start)
+
+	baton.logger.Println("Finished sending the requests")
+	baton.logger.Println("Processing the results...")
+
+	processResults(baton, preparedRunConfiguration)
+	return ctx.Err()
+}
+
+func processResults(baton *Baton, preparedRunConfiguration runConfiguration) {
+	timeSum := int64(0)
+	requestCount := 0
+	requestCounts := make([]int, len(preparedRunConfiguration.preLoadedRequests))
+	for a := 1; a <= baton.configuration.concurrency; a++ {
+		result := <-preparedRunConfiguration.results
+		baton.result.httpResult.connectionErrorCount += result.connectionErrorCount
+		baton.result.httpResult.timeoutCount += result.timeoutCount
+		baton.result.httpResult.templateErrorCount += result.templateErrorCount
+		baton.result.httpResult.status1xxCount += result.status1xxCount
+		baton.result.httpResult.status2xxCount += result.status2xxCount
+		baton.result.httpResult.status3xxCount += result.status3xxCount
+		baton.result.httpResult.status4xxCount += result.status4xxCount
+		baton.result.httpResult.status5xxCount += result.status5xxCount
+		baton.result.httpResult.expectationFailures += result.expectationFailures
+		baton.result.httpResult.errorExpectations += result.errorExpectations
+		baton.result.httpResult.scenarioResult.merge(result.scenarioResult)
+
+		for b := 0; b < len(result.responseTimes); b++ {
+			baton.result.httpResult.responseTimes = append(baton.result.httpResult.responseTimes, result.responseTimes[b])
+		}
+
+		baton.result.httpResult.censoredTimes = append(baton.result.httpResult.censoredTimes, result.censoredTimes...)
+
+		for b := 0; b < len(result.requestCounts); b++ {
+			requestCounts[b] += result.requestCounts[b]
+		}
+
+		timeSum += result.timeSum
+		requestCount += result.totalSuccess
+	}
+	if preparedRunConfiguration.preLoadedRequestsMode {
+		baton.result.requestMix = buildRequestMix(preparedRunConfiguration.preLoadedRequests, requestCounts)
+		for _, request := range preparedRunConfiguration.preLoadedRequests {
+			baton.result.hasExpectations = baton.result.hasExpectations || request.expect != nil
+		}
+	}
+	if preparedRunConfiguration.scenario != nil {
+		baton.result.scenario = preparedRunConfiguration.scenario
+		for _, step := range preparedRunConfiguration.scenario.steps {
+			baton.result.hasExpectations = baton.result.hasExpectations || step.request.expect != nil
+		}
+	}
+	baton.result.hasExpectations = baton.result.hasExpectations || len(baton.configuration.hooks) > 0
+	if preparedRunConfiguration.script != nil {
+		baton.result.hasExpectations = baton.result.hasExpectations || preparedRunConfiguration.script.checkResponse != nil
+		baton.result.metrics = preparedRunConfiguration.script.sortedMetrics()
+	}
+	baton.result.hasStats = baton.configuration.duration == 0
+	baton.result.connectionsOpened = int(atomic.LoadUint64(preparedRunConfiguration.connectionsOpened))
+	baton.result.countsConnections = baton.configuration.transport == nil
+	baton.result.maxStreams = maxConcurrentStreams(preparedRunConfiguration.transports)
+	for _, transport := range preparedRunConfiguration.transports {
+		if handshaker, ok := transport.(*handshaker); ok {
+			baton.result.httpResult.handshakeResult.merge(handshaker.result)
+		}
+	}
+	// The time waited by the requests which timed out counts as their response time, which makes the average and the
+	// max lower bounds of the actual ones
+	censoredTimes := baton.result.httpResult.censoredTimes
+	for _, censoredTime := range censoredTimes {
+		timeSum += int64(censoredTime)
+	}
+	baton.result.averageTime = float32(timeSum) / float32(requestCount+len(censoredTimes))
+	baton.result.totalRequests = baton.result.httpResult.total()
+	baton.result.requestsPerSecond = int(float64(baton.result.totalRequests)/baton.result.timeTaken.Seconds() + 0.5)
+
+	//Find new min and max
+	min := math.MaxInt64
+	max := 0
+	for b := 0; b < len(baton.result.httpResult.responseTimes); b++ {
+		if baton.result.httpResult.responseTimes[b] < min {
+			min = baton.result.httpResult.responseTimes[b]
+		}
+		if baton.result.httpResult.responseTimes[b] > max {
+			max = baton.result.httpResult.responseTimes[b]
+		}
+	}
+	baton.result.minTime = min
+	baton.result.maxTime = max
+	if len(censoredTimes) > 0 {
+		if len(baton.result.httpResult.responseTimes) == 0 {
+			baton.result.minTime = minimum(censoredTimes)
+		}
+		if censoredMax := maximum(censoredTimes); censoredMax > baton.result.maxTime {
+			baton.result.maxTime = censoredMax
+		}
+	}
+	if len(baton.result.httpResult.responseTimes) == 0 {
+		return
+	}
+
+	//Find brackets, out of every request including those which timed out, which are never within a bracket
+	samples := len(baton.result.httpResult.responseTimes) + len(censoredTimes)
+	var numOfBrackets = 10
+	rtCounts := make([][3]int, numOfBrackets)
+	bs := (max - min) / numOfBrackets
+	if bs < 1 {
+		bs = 1
+	}
+	for i := 0; i < numOfBrackets; i++ {
+		if min+(bs*(i+1)) < max {
+			rtCounts[i][0] = min + (bs * (i + 1))
+		}
+	}
+	rtCounts[numOfBrackets-1][0] = max
+
+	for b := 0; b < len(baton.result.httpResult.responseTimes); b++ {
+		for i := 0; i < numOfBrackets; i++ {
+			if baton.result.httpResult.responseTimes[b] <= rtCounts[i][0] {
+				rtCounts[i][1] += 1
+				rtCounts[i][2] = int((float64(rtCounts[i][1]) / float64(samples)) * 100)
+			}
+		}
+	}
+
+	baton.result.httpResult.responseTimesPercent = rtCounts
+
+}
+
+func buildRequestMix(requests []preLoadedRequest, requestCounts []int) []requestMixEntry {
+	totalWeight, totalCount := 0, 0
+	for i := 0; i < len(requests); i++ {
+		totalWeight += requests[i].weight
+		totalCount += requestCounts[i]
+	}
+
+	requestMix := make([]requestMixEntry, len(requests))
+	for i := 0; i < len(requests); i++ {
+		requestMix[i].label = requests[i].name
+		requestMix[i].group = requests[i].group
+		if requestMix[i].label == "" {
+			requestMix[i].label = requests[i].method + " " + requests[i].url
+		}
+		requestMix[i].count = requestCounts[i]
+		requestMix[i].expectedPercent = float64(requests[i].weight) / float64(totalWeight) * 100
+		if totalCount > 0 {
+			requestMix[i].actualPercent = float64(requestCounts[i]) / float64(totalCount) * 100
+		}
+	}
+	return requestMix
+}
+
+// newLogger returns the logger of a run, which leaves the standard logger of the program embedding Baton alone
+func newLogger(suppressOutput bool) *log.Logger {
+
+	logWriter := &logWriter{true}
+
+	if suppressOutput {
+		logWriter.Disable()
+	}
+
+	return log.New(logWriter, "", 0)
+}
+
+func newClient(configuration Configuration, tlsConfig *tls.Config, connectionsOpened *uint64) *fasthttp.Client {
+	client := &fasthttp.Client{TLSConfig: tlsConfig}
+	client.Dial = newDialFunc(configuration, connectionsOpened, nil)
+	client.MaxIdleConnDuration = configuration.idleTimeout
+	client.MaxConnsPerHost = configuration.maxConnsPerHost
+	return client
+}
+
+// newTransports returns the transport of each virtual user. They share one, unless they need connections or TLS
+// sessions of their own, or are spread over the connections of HTTP/2.
+func newTransports(configuration Configuration, tlsConfig *tls.Config, connectionsOpened *uint64) []Transport {
+	transports := make([]Transport, configuration.concurrency)
+	var shared Transport
+	switch {
+	case configuration.transport != nil:
+		shared = configuration.transport
+	case configuration.tlsHandshake:
+		for w := range transports {
+			transports[w] = newHandshaker(configuration, tlsConfig, connectionsOpened)
+		}
+		return transports
+	case configuration.pipeline > 0:
+		shared = &fastHTTPTransport{newPipelineClient(configuration, tlsConfig, connectionsOpened), nil}
+	case configuration.http2:
+		http2Transports := newHTTP2Transports(configuration, tlsConfig, connectionsOpened)
+		for w := range transports {
+			transports[w] = http2Transports[w%len(http2Transports)]
+		}
+		return transports
+	case configuration.vuConnections || configuration.readTimeout > 0 || configuration.connLimit() > 1:
+		for w := range transports {
+			client := newClient(configuration, tlsConfig, connectionsOpened)
+			if configuration.vuConnections || configuration.connLimit() > 1 {
+				// Requests are only counted per connection when the virtual user has a single one
+				client.MaxConnsPerHost = 1
+			}
+			var readTimedOut *uint32
+			if configuration.readTimeout > 0 {
+				// The virtual user keeps its own connections so that a read timing out is put down to its request
+				readTimedOut = new(uint32)
+				client.Dial = newDialFunc(configuration, connectionsOpened, readTimedOut)
+			}
+			transports[w] = &fastHTTPTransport{client, readTimedOut}
+		}
+		return transports
+	default:
+		shared = &fastHTTPTransport{newClient(configuration, tlsConfig, connectionsOpened), nil}
+	}
+	for w := range transports {
+		transports[w] = shared
+	}
+	return transports
+}
+
+func prepareRun(ctx context.Context, configuration Configuration, logger *log.Logger) (runConfiguration, error) {
+
+	preLoadedRequestsMode := false
+	timedMode := false
+
+	var preLoadedRequests []preLoadedRequest
+	var requestSelectors []requestSelector
+
+	headers, err := parseHeaders(configuration.headers)
+	if err != nil {
+		return runConfiguration{}, err
+	}
+
+	if configuration.source != nil {
+		var err error
+		preLoadedRequests, err = preLoadRequestsFromSource(configuration.source)
+		preLoadedRequestsMode = true
+		if err != nil {
+			return runConfiguration{}, errors.New("failed to get requests from source: " + err.Error())
+		}
+		if len(preLoadedRequests) == 0 {
+			return runConfiguration{}, errors.New("no requests provided by the source")
+		}
+	} else if configuration.requestsFromFile != "" {
+		var err error
+		preLoadedRequests, err = preLoadRequestsFromFile(configuration, logger)
+		preLoadedRequestsMode = true
+		if err != nil {
+			return runConfiguration{}, errors.New("failed to parse requests from file: " + configuration.requestsFromFile + ": " + err.Error())
+		}
+		if len(preLoadedRequests) == 0 {
+			return runConfiguration{}, errors.New("no requests found in file: " + configuration.requestsFromFile)
+		}
+	}
+	if preLoadedRequestsMode {
+		for i := range preLoadedRequests {
+			preLoadedRequests[i].headers = addHeaders(preLoadedRequests[i].headers, headers)
+		}
+		// The recorded timing is kept in file order, unless an order which does not follow the file is asked for
+		requestOrder := configuration.requestOrder
+		keepTiming := configuration.keepTiming && hasRecordedTiming(preLoadedRequests) && requestOrder != randomOrder && requestOrder != loopOrder
+		if keepTiming && requestOrder == "" {
+			requestOrder = sequentialOrder
+		}
+		requestSelectors = newRequestSelectors(requestOrder, preLoadedRequests, configuration.concurrency, keepTiming, configuration.replaySpeed, ctx.Done())
+		if configuration.numberOfRequests == 0 && (keepTiming || requestOrder == sequentialOrder || requestOrder == partitionOrder) {
+			// A replay, and the orders sending each request once, send the whole file once unless told otherwise
+			configuration.numberOfRequests = len(preLoadedRequests)
+		}
+	}
+	if configuration.numberOfRequests == 0 {
+		configuration.numberOfRequests = 1
+	}
+
+	if configuration.duration != 0 {
+		timedMode = true
+	}
+
+	tlsConfig, err := newTLSConfig(configuration)
+	if err != nil {
+		return runConfiguration{}, err
+	}
+	connectionsOpened := new(uint64)
+	transports := newTransports(configuration, tlsConfig, connectionsOpened)
+
+	body := configuration.body
+	if configuration.dataFilePath != "" {
+		data, err := ioutil.ReadFile(configuration.dataFilePath)
+		if err != nil {
+			return runConfiguration{}, err
+		}
+		body = string(data)
+	}
+
+	sequence := new(uint64)
+	singleRequest := []preLoadedRequest{{method: configuration.method, url: configuration.url, body: body, headers: addHeaders([][]string{}, headers), weight: 1}}
+	if err := compileRequestTemplates(singleRequest, sequence); err != nil {
+		return runConfiguration{}, errors.New("invalid template: " + err.Error())
+	}
+	// The requests of a file or source are only templates when asked for, as they may contain {{ for other reasons
+	if configuration.templateRequests {
+		if err := compileRequestTemplates(preLoadedRequests, sequence); err != nil {
+			return runConfiguration{}, errors.New("invalid template in requests file: " + err.Error())
+		}
+	}
+
+	var scenario *scenario
+	if configuration.scenarioFile != "" {
+		var err error
+		if scenario, err = loadScenario(configuration.scenarioFile, headers, sequence); err != nil {
+			return runConfiguration{}, errors.New("failed to load scenario from file: " + configuration.scenarioFile + ": " + err.Error())
+		}
+	}
+
+	var script *script
+	if configuration.script != "" {
+		var err error
+		if script, err = loadScript(configuration.script, logger); err != nil {
+			return runConfiguration{}, errors.New("failed to load script from file: " + configuration.script + ": " + err.Error())
+		}
+		if script.nextRequest != nil && (preLoadedRequestsMode || scenario != nil) {
+			return runConfiguration{}, errors.New("a script generating requests cannot be used together with a scenario, a requests file or a request source")
+		}
+	}
+
+	thinkTime, err := parseThinkTime(configuration.thinkTime)
+	if err != nil {
+		return runConfiguration{}, err
+	}
+
+	dataFeeders, err := loadDataFeeders(splitList(configuration.dataFiles), configuration.dataMode, configuration.concurrency)
+	if err != nil {
+		return runConfiguration{}, errors.New("failed to load data: " + err.Error())
+	}
+
+	if scenario != nil {
+		logger.Printf("Configuring to run scenario %s (%d steps)\n", scenario.name, len(scenario.steps))
+	} else if preLoadedRequestsMode {
+		logger.Printf("Configuring to send requests from file. (Read %d requests)\n", len(preLoadedRequests))
+	} else if script != nil && script.nextRequest != nil {
+		logger.Printf("Configuring to send the requests generated by script %s\n", configuration.script)
+	} else {
+		logger.Printf("Configuring to send %s requests to: %s\n", configuration.method, configuration.url)
+	}
+
+	requests := make(chan bool, configuration.numberOfRequests)
+	results := make(chan HTTPResult, configuration.concurrency)
+	done := make(chan bool, configuration.concurrency)
+
+	logger.Println("Generating the requests...")
+	for r := 1; r <= configuration.numberOfRequests; r++ {
+		requests <- true
+	}
+	close(requests)
+	logger.Println("Finished generating the requests")
+
+	preparedRunConfiguration := runConfiguration{
+		preLoadedRequestsMode,
+		timedMode,
+		preLoadedRequests,
+		requestSelectors,
+		dataFeeders,
+		singleRequest[0],
+		scenario,
+		script,
+		pacing{thinkTime, configuration.pacing},
+		transports,
+		connectionsOpened,
+		requests,
+		results,
+		done,
+		body,
+	}
+
+	return preparedRunConfiguration, nil
+}
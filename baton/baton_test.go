@@ -0,0 +1,1964 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/valyala/fasthttp"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type HTTPTestHandler struct {
+	noRequestsReceived  uint32
+	lastBodyReceived    string
+	lastMethodReceived  string
+	lastURIReceived     string
+	lastHeadersReceived *fasthttp.RequestHeader
+	lastTimestamp       int64
+}
+
+func (h *HTTPTestHandler) HandleRequest(ctx *fasthttp.RequestCtx) {
+	atomic.AddUint32(&h.noRequestsReceived, 1)
+	atomic.StoreInt64(&h.lastTimestamp, time.Now().Unix())
+	h.lastBodyReceived = hex.EncodeToString(ctx.Request.Body())
+	h.lastMethodReceived = string(ctx.Request.Header.Method())
+	h.lastURIReceived = ctx.Request.URI().String()
+	newHeader := fasthttp.RequestHeader{}
+	ctx.Request.Header.CopyTo(&newHeader)
+	h.lastHeadersReceived = &newHeader
+
+}
+
+func (h *HTTPTestHandler) reset() {
+	h.noRequestsReceived = 0
+	h.lastBodyReceived = ""
+	h.lastMethodReceived = ""
+	h.lastURIReceived = ""
+	h.lastTimestamp = 0
+}
+
+var serverRunning = false
+var internalHandlerRef *HTTPTestHandler
+var port = "8888"
+
+func startServer() *HTTPTestHandler {
+	if !serverRunning {
+		internalHandlerRef = &HTTPTestHandler{0, "", "", "", &fasthttp.RequestHeader{}, 0}
+		serverRunning = true
+		go func() {
+			err := fasthttp.ListenAndServe(":"+port, internalHandlerRef.HandleRequest)
+			if err != nil {
+				fmt.Printf("Failed to bind on port %s. Make sure no other service is running on that port and restart the test\n", port)
+				os.Exit(1)
+			}
+		}()
+		return internalHandlerRef
+	}
+	internalHandlerRef.reset()
+	return internalHandlerRef
+}
+
+func defaultConfig() Configuration {
+	return Configuration{
+		concurrency:      1,
+		dataMode:         "sequential",
+		keepTiming:       true,
+		method:           "GET",
+		numberOfRequests: 1,
+		pipelineConns:    1,
+		replaySpeed:      1,
+		suppressOutput:   true,
+		url:              "http://localhost:" + port,
+	}
+}
+
+func setupAndListen(config Configuration) *HTTPTestHandler {
+	testHandler := startServer()
+	// Give server enough time to spin
+	time.Sleep(time.Duration(500) * time.Millisecond)
+	// Create a baton instance with given config
+	baton := &Baton{configuration: config, result: Result{}}
+	baton.run(context.Background())
+	// Give server enough time to receive requests
+	time.Sleep(time.Duration(500) * time.Millisecond)
+	// Collect results from handler
+	return testHandler
+}
+
+func TestRequestCount(t *testing.T) {
+	noRequestsToSend := 10000
+
+	config := defaultConfig()
+	config.numberOfRequests = noRequestsToSend
+	testHandler := setupAndListen(config)
+
+	reqsReceived := int(testHandler.noRequestsReceived)
+	if reqsReceived != noRequestsToSend {
+		t.Errorf("Wrong number of requests sent. Expected %d, got %d", noRequestsToSend, reqsReceived)
+	}
+}
+
+func TestRequestCountWithMoreWorkers(t *testing.T) {
+	noRequestsToSend := 100000
+
+	config := defaultConfig()
+	config.concurrency = 10
+	config.numberOfRequests = noRequestsToSend
+	testHandler := setupAndListen(config)
+
+	reqsReceived := int(testHandler.noRequestsReceived)
+	if reqsReceived != noRequestsToSend {
+		t.Errorf("Wrong number of requests sent. Expected %d, got %d", noRequestsToSend, reqsReceived)
+	}
+}
+
+func TestThatBodyHasCorrectValue(t *testing.T) {
+	body := "Hello World"
+	bodyBytes := hex.EncodeToString([]byte(body))
+
+	config := defaultConfig()
+	config.body = body
+	config.method = "POST"
+	testHandler := setupAndListen(config)
+
+	bytesReceived := testHandler.lastBodyReceived
+	if bytesReceived != bodyBytes {
+		t.Errorf("The body received by the server didn't match. Expected %s, got %s", bodyBytes, bytesReceived)
+	}
+}
+
+func TestThatTheCorrectHTTPMethodIsUsed(t *testing.T) {
+	method := "DELETE"
+
+	config := defaultConfig()
+	config.method = method
+	testHandler := setupAndListen(config)
+
+	methodReceived := testHandler.lastMethodReceived
+	if methodReceived != method {
+		t.Errorf("The HTTP method received by the server didn't match. Expected %s, got %s", method, methodReceived)
+	}
+}
+
+func TestThatServerReceivesCorrectURI(t *testing.T) {
+	uri := "http://localhost:" + port + "/path/to/complex?uri&with=html&entities=&#ef"
+
+	config := defaultConfig()
+	config.url = uri
+	testHandler := setupAndListen(config)
+
+	uriReceived := testHandler.lastURIReceived
+	if uriReceived != uri {
+		t.Errorf("The URI received by the server does not match. Expected %s, got %s.", uri, uriReceived)
+	}
+}
+
+func TestLoadPostFromTextFile(t *testing.T) {
+	body := "Hello World"
+	bodyBytes := hex.EncodeToString([]byte(body))
+
+	config := defaultConfig()
+	config.dataFilePath = "test-resources/post-body.txt"
+	config.method = "POST"
+	testHandler := setupAndListen(config)
+
+	bytesReceived := testHandler.lastBodyReceived
+	if bytesReceived != bodyBytes {
+		t.Errorf("The body received by the server didn't match. Expected %s, got %s", bodyBytes, bytesReceived)
+	}
+}
+
+func TestPostRequestLoadedFromFile(t *testing.T) {
+	uri := "http://localhost:" + port
+	method := "POST"
+	fileContents := method + "," + uri + "," + "Data"
+	fileInBytes := []byte(fileContents)
+
+	fileDir := "test-resources/requests-from-file.txt"
+	if ioutil.WriteFile(fileDir, fileInBytes, 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	config := defaultConfig()
+	config.requestsFromFile = fileDir
+	config.numberOfRequests = 2
+	testHandler := setupAndListen(config)
+
+	postBodyInBytes := hex.EncodeToString([]byte("Data"))
+	methodReceived := testHandler.lastMethodReceived
+	bodyReceived := testHandler.lastBodyReceived
+
+	if methodReceived != method {
+		t.Errorf("The HTTP method received by the server didn't match. Expected %s, got %s", method, methodReceived)
+	}
+
+	if bodyReceived != postBodyInBytes {
+		t.Errorf("The body received by the server didn't match. Expected %s, got %s", postBodyInBytes, bodyReceived)
+	}
+}
+
+func TestThatHeadersAreSetWhenSendingFromFile(t *testing.T) {
+	uri := "http://localhost:" + port
+	method := "GET"
+	fileContents := method + "," + uri + "," + "" + "," + "Content-Type: Hello, Secret: World"
+	fileInBytes := []byte(fileContents)
+
+	fileDir := "test-resources/requests-from-file.txt"
+	if ioutil.WriteFile(fileDir, fileInBytes, 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	config := defaultConfig()
+	config.requestsFromFile = fileDir
+	config.numberOfRequests = 1
+	testHandler := setupAndListen(config)
+
+	headerActual := hex.EncodeToString(testHandler.lastHeadersReceived.Peek("Content-Type"))
+	headerExpected := hex.EncodeToString([]byte("Hello"))
+	if headerExpected != headerActual {
+		t.Errorf("Header not found or improperly set, Expected %s, got %s", headerExpected, headerActual)
+	}
+
+	headerActual2 := hex.EncodeToString(testHandler.lastHeadersReceived.Peek("Secret"))
+	headerExpected2 := hex.EncodeToString([]byte("World"))
+	if headerExpected != headerActual {
+		t.Errorf("Header not found or improperly set, Expected %s, got %s", headerExpected2, headerActual2)
+	}
+}
+
+func TestThatTimeOptionRunsForCorrectAmountOfTime(t *testing.T) {
+	duration := 10
+	testHandler := startServer()
+	timeNow := time.Now().Unix()
+
+	config := defaultConfig()
+	config.duration = time.Duration(duration) * time.Second
+
+	baton := &Baton{configuration: config, result: Result{}}
+	baton.run(context.Background())
+
+	time.Sleep(time.Duration(15) * time.Second)
+	lastTimeStamp := testHandler.lastTimestamp
+	epsilonLow := int64(duration - 1)
+	epsilonHigh := int64(duration + 1)
+	diff := lastTimeStamp - timeNow
+	if diff < epsilonLow || diff > epsilonHigh {
+		t.Errorf("Requests sent for longer/shorter than expected. Expected %d, got %d)", duration, diff)
+	}
+}
+
+func TestThatWeightsAreParsedFromFile(t *testing.T) {
+	uri := "http://localhost:" + port
+	fileContents := "GET," + uri + "/a,,3,Accept: text/plain\nGET," + uri + "/b,,,Accept: text/plain"
+
+	fileDir := "test-resources/requests-from-file.txt"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	requests, err := preLoadRequestsFromFile(Configuration{requestsFromFile: fileDir}, newLogger(true))
+	if err != nil {
+		t.Fatalf("Failed to parse requests from file: %v", err)
+	}
+
+	if requests[0].weight != 3 || requests[1].weight != 1 {
+		t.Errorf("Weights not parsed correctly. Expected 3 and 1, got %d and %d", requests[0].weight, requests[1].weight)
+	}
+	if len(requests[0].headers) != 1 || requests[0].headers[0][0] != "Accept" {
+		t.Errorf("Headers following the weight were not parsed, got %v", requests[0].headers)
+	}
+}
+
+func TestThatRequestMixFollowsWeights(t *testing.T) {
+	uri := "http://localhost:" + port
+	fileContents := "GET," + uri + "/read,,9\nPOST," + uri + "/write,,1"
+	noRequestsToSend := 2000
+
+	fileDir := "test-resources/requests-from-file.txt"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	startServer()
+	config := defaultConfig()
+	config.requestsFromFile = fileDir
+	config.numberOfRequests = noRequestsToSend
+	config.concurrency = 2
+	baton := &Baton{configuration: config, result: *newResult()}
+	baton.run(context.Background())
+
+	mix := baton.result.requestMix
+	if len(mix) != 2 {
+		t.Fatalf("Expected a request mix with 2 entries, got %d", len(mix))
+	}
+	if mix[0].count+mix[1].count != noRequestsToSend {
+		t.Errorf("Request mix does not add up. Expected %d, got %d", noRequestsToSend, mix[0].count+mix[1].count)
+	}
+	if mix[0].count <= mix[1].count*4 {
+		t.Errorf("Request mix does not follow weights. Got %d reads and %d writes", mix[0].count, mix[1].count)
+	}
+}
+
+func runRequestOrderTest(t *testing.T, order string, noRequestsToSend int) []requestMixEntry {
+	uri := "http://localhost:" + port
+	fileContents := ""
+	for i := 0; i < 5; i++ {
+		fileContents += "POST," + uri + "/accounts," + strconv.Itoa(i) + "\n"
+	}
+
+	fileDir := "test-resources/requests-from-file.txt"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	startServer()
+	config := defaultConfig()
+	config.requestsFromFile = fileDir
+	config.requestOrder = order
+	config.numberOfRequests = noRequestsToSend
+	config.concurrency = 3
+	baton := &Baton{configuration: config, result: *newResult()}
+	baton.run(context.Background())
+
+	return baton.result.requestMix
+}
+
+func TestThatSequentialOrderSendsEachRequestOnce(t *testing.T) {
+	for _, order := range []string{sequentialOrder, partitionOrder} {
+		mix := runRequestOrderTest(t, order, 20)
+		for i, entry := range mix {
+			if entry.count != 1 {
+				t.Errorf("Request %d sent %d times in %s order, expected exactly once", i, entry.count, order)
+			}
+		}
+	}
+}
+
+func TestThatSequentialOrderSendsTheWholeFileByDefault(t *testing.T) {
+	for _, order := range []string{sequentialOrder, partitionOrder} {
+		mix := runRequestOrderTest(t, order, 0)
+		if len(mix) != 5 {
+			t.Fatalf("Expected the mix of the 5 requests of the file in %s order, got %d entries", order, len(mix))
+		}
+		for i, entry := range mix {
+			if entry.count != 1 {
+				t.Errorf("Request %d sent %d times in %s order without a number of requests, expected exactly once", i, entry.count, order)
+			}
+		}
+	}
+}
+
+func TestThatLoopOrderRepeatsRequests(t *testing.T) {
+	mix := runRequestOrderTest(t, loopOrder, 10)
+	for i, entry := range mix {
+		if entry.count != 2 {
+			t.Errorf("Request %d sent %d times in loop order, expected twice", i, entry.count)
+		}
+	}
+}
+
+func TestThatRequestsAreLoadedFromJSONLFile(t *testing.T) {
+	uri := "http://localhost:" + port
+	fileContents := `{"name": "create", "method": "POST", "url": "` + uri + `/a", "bodyBase64": "SGVsbG8=", "weight": 2, "headers": {"X-Callback": "http://example.com:8080", "Accept": ["a", "b"]}}` + "\n\n" +
+		`{"method": "GET", "url": "` + uri + `/b", "expect": {"status": 200}}` + "\n"
+
+	fileDir := "test-resources/requests-from-file.jsonl"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	requests, err := preLoadRequestsFromFile(Configuration{requestsFromFile: fileDir}, newLogger(true))
+	if err != nil {
+		t.Fatalf("Failed to parse requests from file: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(requests))
+	}
+
+	first := requests[0]
+	if first.name != "create" || first.body != "Hello" || first.weight != 2 {
+		t.Errorf("Request not parsed correctly, got name %q, body %q and weight %d", first.name, first.body, first.weight)
+	}
+	expectedHeaders := [][]string{{"Accept", "a"}, {"Accept", "b"}, {"X-Callback", "http://example.com:8080"}}
+	if fmt.Sprint(first.headers) != fmt.Sprint(expectedHeaders) {
+		t.Errorf("Headers not parsed correctly. Expected %v, got %v", expectedHeaders, first.headers)
+	}
+	if requests[1].weight != 1 || requests[1].expect == nil || requests[1].expect.status != 200 {
+		t.Errorf("Defaults or expectations not parsed correctly, got %+v", requests[1])
+	}
+}
+
+func TestThatHeaderValuesMayContainColons(t *testing.T) {
+	header := extractHeaders("Referer: http://localhost:8080/path")
+	if header == nil || header[0] != "Referer" || header[1] != " http://localhost:8080/path" {
+		t.Errorf("Header with a colon in its value not extracted correctly, got %v", header)
+	}
+}
+
+func TestThatFailedExpectationsAreCounted(t *testing.T) {
+	uri := "http://localhost:" + port
+	fileContents := `{"method": "GET", "url": "` + uri + `/ok", "expect": {"status": 200}}` + "\n" +
+		`{"method": "GET", "url": "` + uri + `/created", "expect": {"status": 201}}` + "\n"
+
+	fileDir := "test-resources/requests-from-file.jsonl"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	startServer()
+	config := defaultConfig()
+	config.requestsFromFile = fileDir
+	config.requestOrder = sequentialOrder
+	config.numberOfRequests = 2
+	baton := &Baton{configuration: config, result: *newResult()}
+	baton.run(context.Background())
+
+	if !baton.result.hasExpectations || baton.result.httpResult.expectationFailures != 1 {
+		t.Errorf("Expected 1 failed expectation, got %d", baton.result.httpResult.expectationFailures)
+	}
+}
+
+func writeHARFile(t *testing.T, fileDir string) {
+	uri := "http://localhost:" + port
+	fileContents := `{"log": {"entries": [
+		{"startedDateTime": "2018-06-01T10:00:01.000Z", "request": {"method": "POST", "url": "` + uri + `/api/orders",
+			"headers": [{"name": ":authority", "value": "localhost"}, {"name": "Content-Type", "value": "application/json"}],
+			"cookies": [{"name": "session", "value": "abc"}, {"name": "theme", "value": "dark"}],
+			"postData": {"mimeType": "application/json", "text": "{\"id\": 1}"}},
+			"response": {"content": {"mimeType": "application/json; charset=utf-8"}}},
+		{"startedDateTime": "2018-06-01T10:00:00.000Z", "request": {"method": "GET", "url": "` + uri + `/api/items", "headers": []},
+			"response": {"content": {"mimeType": "application/json"}}},
+		{"startedDateTime": "2018-06-01T10:00:00.500Z", "request": {"method": "GET", "url": "` + uri + `/logo.png", "headers": []},
+			"response": {"content": {"mimeType": "image/png"}}},
+		{"startedDateTime": "2018-06-01T10:00:00.700Z", "request": {"method": "GET", "url": "http://cdn.example.com/app.js", "headers": []},
+			"response": {"content": {"mimeType": "application/json"}}}
+	]}}`
+
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+}
+
+func TestThatRequestsAreLoadedFromHARFile(t *testing.T) {
+	fileDir := "test-resources/requests-from-file.har"
+	writeHARFile(t, fileDir)
+	defer os.Remove(fileDir)
+
+	config := Configuration{requestsFromFile: fileDir, harDomains: "localhost", harContentTypes: "application/json"}
+	requests, err := preLoadRequestsFromFile(config, newLogger(true))
+	if err != nil {
+		t.Fatalf("Failed to parse requests from file: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests after filtering, got %d", len(requests))
+	}
+
+	if requests[0].method != "GET" || requests[0].offset != 0 {
+		t.Errorf("Entries not sorted by start time, got %s at %s first", requests[0].method, requests[0].offset)
+	}
+	order := requests[1]
+	if order.offset != time.Second {
+		t.Errorf("Wrong offset for the second request. Expected %s, got %s", time.Second, order.offset)
+	}
+	if order.body != `{"id": 1}` {
+		t.Errorf("Post data not loaded, got %q", order.body)
+	}
+	expectedHeaders := [][]string{{"Content-Type", "application/json"}, {"Cookie", "session=abc; theme=dark"}}
+	if fmt.Sprint(order.headers) != fmt.Sprint(expectedHeaders) {
+		t.Errorf("Headers not loaded correctly. Expected %v, got %v", expectedHeaders, order.headers)
+	}
+}
+
+func TestThatRecordedTimingIsKept(t *testing.T) {
+	fileDir := "test-resources/requests-from-file.har"
+	writeHARFile(t, fileDir)
+	defer os.Remove(fileDir)
+
+	startServer()
+	config := defaultConfig()
+	config.requestsFromFile = fileDir
+	config.harDomains = "localhost"
+	config.harContentTypes = "application/json"
+	config.keepTiming = true
+	config.numberOfRequests = 10
+	config.concurrency = 2
+	baton := &Baton{configuration: config, result: *newResult()}
+	baton.run(context.Background())
+
+	if baton.result.timeTaken < time.Second {
+		t.Errorf("Recorded timing not kept, the replay took %s", baton.result.timeTaken)
+	}
+	if baton.result.totalRequests != 2 {
+		t.Errorf("Expected each recorded request to be sent once, got %d requests", baton.result.totalRequests)
+	}
+}
+
+func TestThatAnOrderGivenOverridesTheRecordedTiming(t *testing.T) {
+	fileDir := "test-resources/requests-from-file.har"
+	writeHARFile(t, fileDir)
+	defer os.Remove(fileDir)
+
+	startServer()
+	config := defaultConfig()
+	config.requestsFromFile = fileDir
+	config.harDomains = "localhost"
+	config.harContentTypes = "application/json"
+	config.requestOrder = loopOrder
+	config.numberOfRequests = 4
+	baton := &Baton{configuration: config, result: *newResult()}
+	baton.run(context.Background())
+
+	if baton.result.timeTaken >= time.Second {
+		t.Errorf("Recorded timing kept in loop order, the run took %s", baton.result.timeTaken)
+	}
+	if baton.result.totalRequests != 4 {
+		t.Errorf("Expected the 4 requests asked for in loop order, got %d requests", baton.result.totalRequests)
+	}
+}
+
+func TestThatRequestsAreLoadedFromCurlFile(t *testing.T) {
+	uri := "http://localhost:" + port
+	fileContents := "# Reproduction of the checkout issue\n" +
+		"curl '" + uri + "/api/orders' -H 'Content-Type: application/json' \\\n" +
+		"  -H \"X-Trace: a:b\" --data-raw '{\"id\": 1}' --compressed\n" +
+		"curl -XPUT -u baton:secret " + uri + "/api/items -d @test-resources/post-body.txt\n" +
+		"curl -G " + uri + "/search --data-urlencode 'q=load test' -s -o /dev/null\n" +
+		"curl --retry-delay 2 --max-redirs 5 -L --connect-timeout=3 -m10 " + uri + "/retried\n"
+
+	fileDir := "test-resources/requests-from-file.curl"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	requests, err := preLoadRequestsFromFile(Configuration{requestsFromFile: fileDir}, newLogger(true))
+	if err != nil {
+		t.Fatalf("Failed to parse requests from file: %v", err)
+	}
+	if len(requests) != 4 {
+		t.Fatalf("Expected 4 requests, got %d", len(requests))
+	}
+
+	post := requests[0]
+	expectedHeaders := [][]string{{"Content-Type", "application/json"}, {"X-Trace", "a:b"}, {"Accept-Encoding", "deflate, gzip"}}
+	if post.method != "POST" || post.url != uri+"/api/orders" || post.body != `{"id": 1}` || fmt.Sprint(post.headers) != fmt.Sprint(expectedHeaders) {
+		t.Errorf("First curl command not parsed correctly, got %+v", post)
+	}
+
+	put := requests[1]
+	if put.method != "PUT" || put.body != "Hello World" || put.headers[0][1] != "Basic YmF0b246c2VjcmV0" {
+		t.Errorf("Second curl command not parsed correctly, got %+v", put)
+	}
+
+	search := requests[2]
+	if search.method != "GET" || search.url != uri+"/search?q=load+test" || search.body != "" {
+		t.Errorf("Third curl command not parsed correctly, got %+v", search)
+	}
+
+	retried := requests[3]
+	if retried.method != "GET" || retried.url != uri+"/retried" {
+		t.Errorf("The arguments of the options of the fourth curl command were not skipped, got %+v", retried)
+	}
+
+	if _, err := parseCurlCommand([]string{"curl", "-T", "file.txt", uri}); err == nil || err.Error() != "unsupported option: -T" {
+		t.Errorf("Expected an unsupported option error for -T, got %v", err)
+	}
+}
+
+func TestThatRequestsAreGeneratedFromOpenAPIDocument(t *testing.T) {
+	fileContents := `
+openapi: 3.0.0
+servers:
+  - url: http://{host}/v1
+    variables:
+      host:
+        default: localhost:8888
+paths:
+  /pets/{petId}:
+    parameters:
+      - name: petId
+        in: path
+        schema: {type: integer, example: 42}
+    get:
+      operationId: getPet
+      tags: [pets]
+      parameters:
+        - name: fields
+          in: query
+          required: true
+          schema: {type: string, enum: [name, tag]}
+        - name: verbose
+          in: query
+          schema: {type: boolean}
+    delete:
+      tags: [admin]
+  /pets:
+    post:
+      tags: [pets]
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        name: {type: string, example: Rex}
+        age: {type: integer}
+`
+	fileDir := "test-resources/openapi.yaml"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	requests, err := preLoadRequestsFromFile(Configuration{requestsFromFile: fileDir, openAPIExcludeTags: "admin"}, newLogger(true))
+	if err != nil {
+		t.Fatalf("Failed to parse requests from file: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(requests))
+	}
+
+	create := requests[0]
+	if create.method != "POST" || create.url != "http://localhost:8888/v1/pets" || create.body != `{"age":1,"name":"Rex"}` {
+		t.Errorf("Request with body not generated correctly, got %+v", create)
+	}
+	get := requests[1]
+	if get.name != "getPet" || get.url != "http://localhost:8888/v1/pets/42?fields=name" {
+		t.Errorf("Request with parameters not generated correctly, got %+v", get)
+	}
+
+	requests, err = preLoadRequestsFromFile(Configuration{requestsFromFile: fileDir, openAPIServer: "http://staging/", openAPITags: "admin"}, newLogger(true))
+	if err != nil {
+		t.Fatalf("Failed to parse requests from file: %v", err)
+	}
+	if len(requests) != 1 || requests[0].method != "DELETE" || requests[0].url != "http://staging/v1/pets/42" {
+		t.Errorf("Tags or server not applied, got %+v", requests)
+	}
+}
+
+func TestThatRelativeOpenAPIServersAreResolved(t *testing.T) {
+	fileContents := `{"openapi": "3.0.0", "servers": [{"url": "/v1"}], "paths": {"/items": {"get": {"parameters": [
+		{"name": "sort", "in": "query", "examples": {"newest": {"value": "date"}, "cheapest": {"value": "price"}}}]}}}}`
+	fileDir := "test-resources/openapi.json"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	if _, err := preLoadRequestsFromFile(Configuration{requestsFromFile: fileDir}, newLogger(true)); err == nil {
+		t.Errorf("Expected a relative server without -openapi-server to be rejected")
+	}
+	requests, err := preLoadRequestsFromFile(Configuration{requestsFromFile: fileDir, openAPIServer: "http://localhost:8888/api"}, newLogger(true))
+	if err != nil {
+		t.Fatalf("Failed to parse requests from file: %v", err)
+	}
+	if len(requests) != 1 || requests[0].url != "http://localhost:8888/api/v1/items?sort=price" {
+		t.Errorf("Expected the server to be resolved and the first example by name to be used, got %+v", requests)
+	}
+
+	if ioutil.WriteFile(fileDir, []byte(`{"items": []}`), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	if _, err := preLoadRequestsFromFile(Configuration{requestsFromFile: fileDir}, newLogger(true)); err == nil || !strings.Contains(err.Error(), "-format") {
+		t.Errorf("Expected a JSON file of no known kind to ask for -format, got %v", err)
+	}
+}
+
+func TestThatRequestsAreGeneratedFromSwaggerDocument(t *testing.T) {
+	fileContents := `{"swagger": "2.0", "host": "localhost:8888", "basePath": "/api", "schemes": ["http"],
+		"paths": {"/orders": {"post": {"parameters": [
+			{"name": "X-Request-Id", "in": "header", "required": true, "type": "string", "format": "uuid"},
+			{"name": "order", "in": "body", "schema": {"$ref": "#/definitions/Order"}}]}}},
+		"definitions": {"Order": {"type": "object", "properties": {"items": {"type": "array", "items": {"type": "string", "default": "book"}}}}}}`
+	fileDir := "test-resources/swagger.json"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	requests, err := preLoadRequestsFromFile(Configuration{requestsFromFile: fileDir}, newLogger(true))
+	if err != nil {
+		t.Fatalf("Failed to parse requests from file: %v", err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(requests))
+	}
+
+	order := requests[0]
+	expectedHeaders := [][]string{{"X-Request-Id", "3fa85f64-5717-4562-b3fc-2c963f66afa6"}, {"Content-Type", "application/json"}}
+	if order.url != "http://localhost:8888/api/orders" || order.body != `{"items":["book"]}` || fmt.Sprint(order.headers) != fmt.Sprint(expectedHeaders) {
+		t.Errorf("Request not generated correctly, got %+v", order)
+	}
+
+	requests, err = preLoadRequestsFromFile(Configuration{requestsFromFile: fileDir, openAPIServer: "https://staging/gateway"}, newLogger(true))
+	if err != nil {
+		t.Fatalf("Failed to parse requests from file: %v", err)
+	}
+	if requests[0].url != "https://staging/gateway/api/orders" {
+		t.Errorf("Expected the base path to be kept after the path of the server, got %s", requests[0].url)
+	}
+}
+
+func TestThatRequestsAreLoadedFromPostmanCollection(t *testing.T) {
+	collection := `{"info": {"schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"},
+		"variable": [{"key": "baseUrl", "value": "http://example.com"}, {"key": "token", "value": "secret"}],
+		"auth": {"type": "bearer", "bearer": [{"key": "token", "value": "{{token}}", "type": "string"}]},
+		"item": [
+			{"name": "Orders", "item": [
+				{"name": "Create", "request": {"method": "POST", "url": {"raw": "{{baseUrl}}/orders"},
+					"header": [{"key": "X-Disabled", "value": "1", "disabled": true}],
+					"body": {"mode": "urlencoded", "urlencoded": [{"key": "item", "value": "book"}]}}},
+				{"name": "Public", "request": {"method": "GET", "url": "{{baseUrl}}/public", "auth": {"type": "noauth"}}},
+				{"name": "Signed", "request": {"method": "GET", "url": "{{baseUrl}}/signed", "auth": {"type": "awsv4"}}}
+			]},
+			{"name": "Search", "auth": {"type": "apikey", "apikey": [{"key": "key", "value": "api_key"}, {"key": "value", "value": "{{token}}"}, {"key": "in", "value": "query"}]},
+				"request": {"method": "GET", "url": "{{baseUrl}}/search?q={{$randomWord}}"}}
+		]}`
+	environment := `{"values": [{"key": "baseUrl", "value": "http://localhost:8888", "enabled": true}]}`
+
+	fileDir := "test-resources/requests.postman_collection.json"
+	environmentDir := "test-resources/requests.postman_environment.json"
+	if ioutil.WriteFile(fileDir, []byte(collection), 0644) != nil || ioutil.WriteFile(environmentDir, []byte(environment), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+	defer os.Remove(environmentDir)
+
+	requests, err := preLoadRequestsFromFile(Configuration{requestsFromFile: fileDir, postmanEnvironment: environmentDir}, newLogger(true))
+	if err != nil {
+		t.Fatalf("Failed to parse requests from file: %v", err)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(requests))
+	}
+
+	create := requests[0]
+	expectedHeaders := [][]string{{"Content-Type", "application/x-www-form-urlencoded"}, {"Authorization", "Bearer secret"}}
+	if create.name != "Create" || create.group != "Orders" || create.url != "http://localhost:8888/orders" || create.body != "item=book" || fmt.Sprint(create.headers) != fmt.Sprint(expectedHeaders) {
+		t.Errorf("Request in folder not loaded correctly, got %+v", create)
+	}
+	if public := requests[1]; len(public.headers) != 0 {
+		t.Errorf("Request without auth should have no headers, got %v", public.headers)
+	}
+	if search := requests[2]; search.url != "http://localhost:8888/search?q={{$randomWord}}&api_key=secret" {
+		t.Errorf("API key not added to the query, got %s", search.url)
+	}
+
+	result := newResult()
+	result.requestMix = buildRequestMix(requests, []int{30, 10, 60})
+	var output bytes.Buffer
+	result.printResults(&output)
+	if !strings.Contains(output.String(), "40  40.00% /  66.67% : Orders/\n") || !strings.Contains(output.String(), "30  30.00% /  33.33% :   Create\n") {
+		t.Errorf("Expected the requests of the folder to be grouped in the request mix, got:\n%s", output.String())
+	}
+}
+
+func TestThatRequestsAreLoadedFromAccessLog(t *testing.T) {
+	fileContents := `10.0.0.1 - - [01/Jun/2018:10:00:02 +0000] "GET /items?page=2 HTTP/1.1" 200 512 "-" "Mozilla/5.0"
+10.0.0.2 - frank [01/Jun/2018:10:00:00 +0000] "GET /items HTTP/1.1" 200 1024
+10.0.0.3 - - [01/Jun/2018:10:00:01 +0000] "POST /orders HTTP/1.1" 201 12 "-" "curl/7.54.0"
+not a log line
+10.0.0.4 - - [01/Jun/2018:10:00:03 +0000] "HEAD /health HTTP/1.1" 200 0 "-" "-"
+`
+	fileDir := "test-resources/access.log"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	requests, err := preLoadRequestsFromFile(Configuration{requestsFromFile: fileDir, logTarget: "http://localhost:" + port + "/"}, newLogger(true))
+	if err != nil {
+		t.Fatalf("Failed to parse requests from file: %v", err)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(requests))
+	}
+
+	expected := []struct {
+		method string
+		url    string
+		offset time.Duration
+	}{
+		{"GET", "http://localhost:" + port + "/items", 0},
+		{"GET", "http://localhost:" + port + "/items?page=2", 2 * time.Second},
+		{"HEAD", "http://localhost:" + port + "/health", 3 * time.Second},
+	}
+	for i, request := range requests {
+		if request.method != expected[i].method || request.url != expected[i].url || request.offset != expected[i].offset {
+			t.Errorf("Request %d not loaded correctly. Expected %+v, got %+v", i, expected[i], request)
+		}
+	}
+	if fmt.Sprint(requests[1].headers) != "[[User-Agent Mozilla/5.0]]" {
+		t.Errorf("User agent not kept, got %v", requests[1].headers)
+	}
+}
+
+func TestThatAccessLogIsReplayedWithScaledTiming(t *testing.T) {
+	fileContents := "2018-06-01T10:00:00Z GET /first\n2018-06-01T10:00:02Z GET /second\n"
+	fileDir := "test-resources/access.log"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	testHandler := startServer()
+	config := defaultConfig()
+	config.requestsFromFile = fileDir
+	config.logTarget = "http://localhost:" + port
+	config.logPattern = `^(?P<time>\S+) (?P<method>\S+) (?P<path>\S+)$`
+	config.replaySpeed = 4
+	config.numberOfRequests = 0
+	baton := &Baton{configuration: config, result: *newResult()}
+	baton.run(context.Background())
+	time.Sleep(time.Duration(100) * time.Millisecond)
+
+	if baton.result.timeTaken < 400*time.Millisecond || baton.result.timeTaken > 1500*time.Millisecond {
+		t.Errorf("Timing not scaled, replaying 2 seconds at 4x speed took %s", baton.result.timeTaken)
+	}
+	if testHandler.lastURIReceived != "http://localhost:"+port+"/second" {
+		t.Errorf("Expected the last request to be sent to /second, got %s", testHandler.lastURIReceived)
+	}
+	if baton.result.totalRequests != 2 {
+		t.Errorf("Expected the whole log to be replayed once by default, got %d requests", baton.result.totalRequests)
+	}
+}
+
+func TestThatCancellingStopsTheReplayBetweenRequests(t *testing.T) {
+	fileContents := "2018-06-01T10:00:00Z GET /first\n2018-06-01T11:00:00Z GET /second\n"
+	fileDir := "test-resources/access.log"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	startServer()
+	config := defaultConfig()
+	config.requestsFromFile = fileDir
+	config.logTarget = "http://localhost:" + port
+	config.logPattern = `^(?P<time>\S+) (?P<method>\S+) (?P<path>\S+)$`
+	config.numberOfRequests = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	baton := &Baton{configuration: config, result: *newResult()}
+	start := time.Now()
+	if err := baton.run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected the run to end with its context, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Replay not stopped while waiting for the next request, the run took %s", elapsed)
+	}
+	if baton.result.totalRequests != 1 {
+		t.Errorf("Expected only the first request to be sent, got %d requests", baton.result.totalRequests)
+	}
+}
+
+func TestThatTemplatesAreEvaluatedForEveryRequest(t *testing.T) {
+	config := defaultConfig()
+	config.url = "http://localhost:" + port + "/items/{{.workerID}}-{{.requestNumber}}"
+	config.body = `{{base64 "Hello"}}`
+	config.method = "POST"
+	config.numberOfRequests = 3
+	testHandler := setupAndListen(config)
+
+	expectedURI := "http://localhost:" + port + "/items/1-3"
+	if testHandler.lastURIReceived != expectedURI {
+		t.Errorf("URL template not evaluated. Expected %s, got %s", expectedURI, testHandler.lastURIReceived)
+	}
+	expectedBody := hex.EncodeToString([]byte("SGVsbG8="))
+	if testHandler.lastBodyReceived != expectedBody {
+		t.Errorf("Body template not evaluated. Expected %s, got %s", expectedBody, testHandler.lastBodyReceived)
+	}
+}
+
+func TestThatRequestsFilesAreOnlyTemplatesWhenAsked(t *testing.T) {
+	fileDir := "test-resources/templates.jsonl"
+	fileContents := `{"method": "POST", "url": "http://localhost:` + port + `/items/{{.workerID}}", "body": "{{unknown}}"}` + "\n"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	config := defaultConfig()
+	config.requestsFromFile = fileDir
+	testHandler := setupAndListen(config)
+
+	expectedURI := "http://localhost:" + port + "/items/%7B%7B.workerID%7D%7D"
+	if testHandler.lastURIReceived != expectedURI || testHandler.lastBodyReceived != hex.EncodeToString([]byte("{{unknown}}")) {
+		t.Errorf("Expected the request to be sent as is, got %s with body %s", testHandler.lastURIReceived, testHandler.lastBodyReceived)
+	}
+
+	config.templateRequests = true
+	if _, err := prepareRun(context.Background(), config, newLogger(true)); err == nil || !strings.Contains(err.Error(), "invalid template in requests file") {
+		t.Errorf("Expected the invalid template to be reported with -template, got %v", err)
+	}
+}
+
+func TestThatRequestsWhoseTemplateFailsAreCountedAsErrors(t *testing.T) {
+	dataDir := "test-resources/ids.csv"
+	if ioutil.WriteFile(dataDir, []byte("id\nfirst\nsecond\n"), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(dataDir)
+
+	testHandler := startServer()
+	config := defaultConfig()
+	// The template renders without data, but randInt cannot take the values of the file
+	config.url = "http://localhost:" + port + "/items/{{if .id}}{{randInt 1 .id}}{{end}}"
+	config.dataFiles = dataDir
+	config.numberOfRequests = 4
+	baton := &Baton{configuration: config, result: *newResult()}
+	if err := baton.run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if baton.result.httpResult.templateErrorCount != 4 || baton.result.totalRequests != 4 {
+		t.Errorf("Expected 4 template errors out of 4 requests, got %d out of %d", baton.result.httpResult.templateErrorCount, baton.result.totalRequests)
+	}
+	if noRequestsReceived := atomic.LoadUint32(&testHandler.noRequestsReceived); noRequestsReceived != 0 {
+		t.Errorf("Expected no request to be sent, got %d", noRequestsReceived)
+	}
+}
+
+func TestTemplateFunctions(t *testing.T) {
+	sequence := new(uint64)
+	requests := []preLoadedRequest{{method: "GET", url: `/{{randInt 5 7}}/{{randString 8}}/{{uuid}}/{{choice "a" "b"}}/{{hex "hi"}}/{{seq}}/{{seq}}`, headers: [][]string{{"X-Time", "{{timestamp}}"}}, weight: 1}}
+	if err := compileRequestTemplates(requests, sequence); err != nil {
+		t.Fatalf("Failed to compile template: %v", err)
+	}
+
+	rendered, err := requests[0].template.render(requests[0], map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("Failed to render template: %v", err)
+	}
+	pattern := regexp.MustCompile(`^/[5-7]/[a-zA-Z0-9]{8}/[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}/[ab]/6869/1/2$`)
+	if !pattern.MatchString(rendered.url) {
+		t.Errorf("Template functions did not render as expected, got %s", rendered.url)
+	}
+	if _, err := strconv.ParseInt(rendered.headers[0][1], 10, 64); err != nil {
+		t.Errorf("Header template not rendered, got %s", rendered.headers[0][1])
+	}
+
+	invalid := []preLoadedRequest{{method: "GET", url: "/{{randInt}}", weight: 1}}
+	if err := compileRequestTemplates(invalid, sequence); err == nil {
+		t.Errorf("Expected an error for an invalid template")
+	}
+}
+
+func TestThatDataFilesFeedTemplates(t *testing.T) {
+	dataDir := "test-resources/users.csv"
+	if ioutil.WriteFile(dataDir, []byte("username,password\nalice,a1\nbob,b2\ncarol,c3\n"), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(dataDir)
+
+	startServer()
+	config := defaultConfig()
+	config.url = "http://localhost:" + port + "/login?user={{.username}}&password={{.password}}"
+	config.dataFiles = dataDir
+	config.dataMode = uniqueData
+	config.numberOfRequests = 10
+	baton := &Baton{configuration: config, result: *newResult()}
+	baton.run(context.Background())
+
+	if baton.result.totalRequests != 3 {
+		t.Errorf("Expected every row to be used exactly once, got %d requests", baton.result.totalRequests)
+	}
+	expectedURI := "http://localhost:" + port + "/login?user=carol&password=c3"
+	if internalHandlerRef.lastURIReceived != expectedURI {
+		t.Errorf("Data not fed into the template. Expected %s, got %s", expectedURI, internalHandlerRef.lastURIReceived)
+	}
+}
+
+func TestDataFeederModes(t *testing.T) {
+	dataDir := "test-resources/keys.json"
+	if ioutil.WriteFile(dataDir, []byte(`[{"key": "k1", "id": 1}, {"key": "k2", "id": 2}]`), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(dataDir)
+
+	feeders, err := loadDataFeeders([]string{dataDir}, sequentialData, 1)
+	if err != nil {
+		t.Fatalf("Failed to load data file: %v", err)
+	}
+	var keys []string
+	for i := 0; i < 3; i++ {
+		row, _ := feeders[0].next(1)
+		keys = append(keys, row["key"]+"/"+row["id"])
+	}
+	if fmt.Sprint(keys) != "[k1/1 k2/2 k1/1]" {
+		t.Errorf("Rows not fed sequentially, got %v", keys)
+	}
+
+	feeders, err = loadDataFeeders([]string{dataDir}, vuData, 2)
+	if err != nil {
+		t.Fatalf("Failed to load data file: %v", err)
+	}
+	first, _ := feeders[0].next(1)
+	second, _ := feeders[0].next(2)
+	again, _ := feeders[0].next(2)
+	if first["key"] != "k1" || second["key"] != "k2" || again["key"] != "k2" {
+		t.Errorf("Rows not bound to virtual users, got %v, %v and %v", first, second, again)
+	}
+
+	if _, err := loadDataFeeders([]string{dataDir}, vuData, 3); err == nil {
+		t.Errorf("Expected an error when there are fewer rows than virtual users")
+	}
+}
+
+var scenarioPort = "8889"
+var scenarioServerOnce sync.Once
+
+// startScenarioServer starts a server implementing a small login and order flow
+func startScenarioServer() {
+	scenarioServerOnce.Do(func() {
+		handler := func(ctx *fasthttp.RequestCtx) {
+			switch string(ctx.Path()) {
+			case "/login":
+				ctx.SetBodyString(`{"session": {"token": "abc"}}`)
+			case "/orders":
+				if string(ctx.Request.Header.Peek("Authorization")) != "Bearer abc" {
+					ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+					return
+				}
+				ctx.Response.Header.Set("Location", "/orders/42")
+				ctx.SetStatusCode(fasthttp.StatusCreated)
+			case "/orders/42":
+				ctx.SetBodyString("order id=42")
+			case "/session":
+				ctx.Response.Header.Set("Set-Cookie", "sid=s3cr3t; Path=/")
+				ctx.Response.Header.Add("Set-Cookie", "admin=1; Path=/admin")
+			case "/slow":
+				time.Sleep(300 * time.Millisecond)
+			case "/whoami":
+				if len(ctx.Request.Header.Cookie("admin")) > 0 {
+					ctx.SetStatusCode(fasthttp.StatusBadRequest)
+				} else if string(ctx.Request.Header.Cookie("sid")) != "s3cr3t" {
+					ctx.SetStatusCode(fasthttp.StatusUnauthorized)
+				}
+			default:
+				ctx.SetStatusCode(fasthttp.StatusNotFound)
+			}
+		}
+		go fasthttp.ListenAndServe(":"+scenarioPort, handler)
+		time.Sleep(time.Duration(500) * time.Millisecond)
+	})
+}
+
+func TestThatScenarioStepsAreChained(t *testing.T) {
+	uri := "http://localhost:" + scenarioPort
+	fileContents := `
+name: checkout
+steps:
+  - name: login
+    method: POST
+    url: ` + uri + `/login
+    extract:
+      - {name: token, jsonPath: $.session.token}
+  - name: create order
+    method: POST
+    url: ` + uri + `/orders
+    headers: {Authorization: "Bearer {{.token}}"}
+    expect: {status: 201}
+    extract:
+      - {name: location, header: Location}
+  - name: get order
+    method: GET
+    url: ` + uri + `{{.location}}
+    extract:
+      - {name: id, regex: 'id=(\d+)'}
+`
+	fileDir := "test-resources/scenario.yaml"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	startScenarioServer()
+	config := defaultConfig()
+	config.scenarioFile = fileDir
+	config.numberOfRequests = 5
+	config.concurrency = 2
+	baton := &Baton{configuration: config, result: *newResult()}
+	baton.run(context.Background())
+
+	scenarioResult := baton.result.httpResult.scenarioResult
+	if scenarioResult.flow.count != 5 || scenarioResult.flow.failures != 0 {
+		t.Errorf("Expected 5 successful flows, got %d with %d failures", scenarioResult.flow.count, scenarioResult.flow.failures)
+	}
+	for i, step := range scenarioResult.steps {
+		if step.count != 5 || step.failures != 0 {
+			t.Errorf("Expected step %d to succeed 5 times, got %d with %d failures", i+1, step.count, step.failures)
+		}
+	}
+	if baton.result.httpResult.status2xxCount != 15 {
+		t.Errorf("Expected 15 successful responses, got %d", baton.result.httpResult.status2xxCount)
+	}
+}
+
+func TestThatScenarioStepsAreNumberedAsRequests(t *testing.T) {
+	uri := "http://localhost:" + port
+	fileContents := `
+steps:
+  - {method: GET, url: "` + uri + `/first/{{.requestNumber}}"}
+  - {method: GET, url: "` + uri + `/second/{{.requestNumber}}"}
+`
+	fileDir := "test-resources/numbered-scenario.yaml"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	config := defaultConfig()
+	config.scenarioFile = fileDir
+	config.numberOfRequests = 2
+	testHandler := setupAndListen(config)
+
+	expectedURI := uri + "/second/4"
+	if testHandler.lastURIReceived != expectedURI {
+		t.Errorf("Expected every step to be numbered, got %s instead of %s", testHandler.lastURIReceived, expectedURI)
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	document := []byte(`{"orders": [{"order id": 7, "items": ["a", "b"]}], "total": {"amount": 1.5}}`)
+	tests := map[string]string{
+		"$.orders[0]['order id']": "7",
+		"$.orders[0].items[-1]":   "b",
+		"$.total":                 `{"amount":1.5}`,
+	}
+	for path, expected := range tests {
+		parsed, err := parseJSONPath(path)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", path, err)
+		}
+		if value, ok := evaluateJSONPath(document, parsed); !ok || value != expected {
+			t.Errorf("Wrong value for %s. Expected %s, got %s", path, expected, value)
+		}
+	}
+
+	parsed, _ := parseJSONPath("$.missing.key")
+	if _, ok := evaluateJSONPath(document, parsed); ok {
+		t.Errorf("Expected no value for a missing key")
+	}
+}
+
+func TestThatVirtualUsersKeepCookies(t *testing.T) {
+	uri := "http://localhost:" + scenarioPort
+	fileContents := `{"name": "session", "steps": [
+		{"method": "GET", "url": "` + uri + `/session"},
+		{"method": "GET", "url": "` + uri + `/whoami", "expect": {"status": 200}}]}`
+	fileDir := "test-resources/scenario.json"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	startScenarioServer()
+	for _, keepCookies := range []bool{false, true} {
+		config := defaultConfig()
+		config.scenarioFile = fileDir
+		config.numberOfRequests = 4
+		config.concurrency = 2
+		config.keepCookies = keepCookies
+		config.vuConnections = true
+		baton := &Baton{configuration: config, result: *newResult()}
+		baton.run(context.Background())
+
+		failures := baton.result.httpResult.scenarioResult.flow.failures
+		if keepCookies && failures != 0 {
+			t.Errorf("Expected the session cookie to be sent back, got %d failed flows", failures)
+		}
+		if !keepCookies && failures != 4 {
+			t.Errorf("Expected cookies to be ignored, got %d failed flows", failures)
+		}
+	}
+}
+
+func TestThinkTimeDistributions(t *testing.T) {
+	cases := []struct {
+		spec     string
+		min, max time.Duration
+	}{
+		{"250ms", 250 * time.Millisecond, 250 * time.Millisecond},
+		{"fixed:1s", time.Second, time.Second},
+		{"uniform:1s,3s", time.Second, 3 * time.Second},
+		{"normal:2s,500ms", 0, time.Hour},
+		{"exponential:2s", 0, time.Hour},
+	}
+	for _, c := range cases {
+		thinkTime, err := parseThinkTime(c.spec)
+		if err != nil {
+			t.Fatalf("Failed to parse think time %s: %v", c.spec, err)
+		}
+		for i := 0; i < 100; i++ {
+			if delay := thinkTime.next(); delay < c.min || delay > c.max {
+				t.Errorf("Think time %s out of range, got %s", c.spec, delay)
+			}
+		}
+	}
+
+	for _, spec := range []string{"soon", "poisson:1s", "uniform:3s,1s", "normal:1s", "-1s"} {
+		if _, err := parseThinkTime(spec); err == nil {
+			t.Errorf("Expected an error for think time %s", spec)
+		}
+	}
+}
+
+func TestThatPacingAbsorbsResponseTime(t *testing.T) {
+	config := defaultConfig()
+	config.numberOfRequests = 4
+	config.pacing = 200 * time.Millisecond
+	baton := &Baton{configuration: config, result: *newResult()}
+	startServer()
+	baton.run(context.Background())
+
+	if baton.result.timeTaken < 800*time.Millisecond || baton.result.timeTaken > 1500*time.Millisecond {
+		t.Errorf("Expected 4 iterations paced at 200ms to take about 800ms, took %s", baton.result.timeTaken)
+	}
+
+	config.pacing = 0
+	config.thinkTime = "100ms"
+	baton = &Baton{configuration: config, result: *newResult()}
+	baton.run(context.Background())
+
+	if baton.result.timeTaken < 400*time.Millisecond {
+		t.Errorf("Expected a think time of 100ms after each of 4 requests, took %s", baton.result.timeTaken)
+	}
+}
+
+type reportRecorder struct {
+	reports []Report
+}
+
+func (recorder *reportRecorder) Write(report Report) error {
+	recorder.reports = append(recorder.reports, report)
+	return nil
+}
+
+func TestThatRunUsesRequestSourceAndSinks(t *testing.T) {
+	testHandler := startServer()
+	recorder := &reportRecorder{}
+	source := RequestList{
+		{URL: "http://localhost:" + port + "/first", Headers: http.Header{"X-Source": {"list"}}},
+		{Method: "POST", URL: "http://localhost:" + port + "/second", Body: "{{.requestNumber}}", Weight: 3},
+	}
+	report, err := Run(context.Background(), Config{Source: source, Headers: []string{"X-Run: api"}, Requests: 20, RequestOrder: "loop", Quiet: true, Sinks: []ResultSink{recorder}})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	time.Sleep(time.Duration(100) * time.Millisecond)
+
+	if report.TotalRequests != 20 || report.Status2xx != 20 || !report.HasResponseTimes {
+		t.Errorf("Expected 20 successful requests, got %+v", report)
+	}
+	if len(recorder.reports) != 1 || recorder.reports[0].TotalRequests != 20 {
+		t.Errorf("Expected the report to be written to the sink once, got %d reports", len(recorder.reports))
+	}
+	if noRequestsReceived := atomic.LoadUint32(&testHandler.noRequestsReceived); noRequestsReceived != 20 {
+		t.Errorf("Expected 20 requests, got %d", noRequestsReceived)
+	}
+	if string(testHandler.lastHeadersReceived.Peek("X-Run")) != "api" {
+		t.Errorf("Expected the headers of the configuration to be sent, got %s", testHandler.lastHeadersReceived.String())
+	}
+}
+
+func TestThatRunLeavesTheStandardLoggerAlone(t *testing.T) {
+	startServer()
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	log.SetFlags(log.Lshortfile)
+	defer log.SetOutput(os.Stderr)
+	defer log.SetFlags(log.LstdFlags)
+
+	if _, err := Run(context.Background(), Config{URL: "http://localhost:" + port, Requests: 5, Quiet: true}); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	log.Print("still logging")
+
+	if log.Flags() != log.Lshortfile || !strings.Contains(output.String(), "still logging") {
+		t.Errorf("Expected the standard logger to be left as it was, got flags %d and output %q", log.Flags(), output.String())
+	}
+}
+
+func TestThatRunStopsWhenCancelled(t *testing.T) {
+	startServer()
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	report, err := Run(ctx, Config{URL: "http://localhost:" + port, Duration: 10 * time.Second, ThinkTime: "100ms", Quiet: true})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected the error of the context, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the run to stop when cancelled, took %s", elapsed)
+	}
+	if report.TotalRequests == 0 {
+		t.Errorf("Expected the report of the requests sent before cancelling")
+	}
+}
+
+func TestThatCancellingInterruptsTheRequestsInFlight(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	for _, config := range []Config{
+		{URL: server.URL, Requests: 5, Concurrency: 2, Quiet: true},
+		{URL: server.URL, Duration: 10 * time.Second, Concurrency: 2, VUConnections: true, Quiet: true},
+		{URL: server.URL, Requests: 5, Concurrency: 2, Transport: NewHTTPTransport(&http.Client{}), Quiet: true},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		start := time.Now()
+		report, err := Run(ctx, config)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Errorf("Expected the error of the context, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Expected the requests waiting for a response to be interrupted when cancelled, the run took %s", elapsed)
+		}
+		if report.TotalRequests != 0 {
+			t.Errorf("Expected the interrupted requests not to be counted, got %d: %+v", report.TotalRequests, report)
+		}
+	}
+}
+
+func TestThatHooksAreChained(t *testing.T) {
+	testHandler := startServer()
+	var correlationID, responses uint32
+	hooks := []Hook{
+		HookFuncs{Before: func(request *OutgoingRequest) {
+			request.Headers.Set("X-Correlation-ID", strconv.Itoa(int(atomic.AddUint32(&correlationID, 1))))
+		}},
+		HookFuncs{
+			Before: func(request *OutgoingRequest) {
+				mac := hmac.New(sha256.New, []byte("secret"))
+				mac.Write([]byte(request.Headers.Get("X-Correlation-ID")))
+				request.Headers.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+			},
+			After: func(request *OutgoingRequest, response *Response) error {
+				if atomic.AddUint32(&responses, 1)%2 == 0 {
+					return errors.New("every other response fails")
+				}
+				return nil
+			},
+		},
+	}
+	report, err := Run(context.Background(), Config{URL: "http://localhost:" + port, Requests: 10, Hooks: hooks, Quiet: true})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	time.Sleep(time.Duration(100) * time.Millisecond)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("10"))
+	if string(testHandler.lastHeadersReceived.Peek("X-Signature")) != hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("Expected the signature of the last correlation ID, got %s", testHandler.lastHeadersReceived.String())
+	}
+	if responses != 10 || report.ExpectationFailures != 5 {
+		t.Errorf("Expected 5 out of 10 responses to fail, got %d out of %d", report.ExpectationFailures, responses)
+	}
+}
+
+func TestThatFailedRequestsAreCountedOnce(t *testing.T) {
+	var calls uint32
+	transport := TransportFunc(func(ctx context.Context, request *OutgoingRequest) (*Response, error) {
+		if atomic.AddUint32(&calls, 1)%2 == 0 {
+			return &Response{503, http.Header{}, nil}, nil
+		}
+		return &Response{200, http.Header{}, nil}, nil
+	})
+	failAll := HookFuncs{After: func(request *OutgoingRequest, response *Response) error {
+		return errors.New("every response fails")
+	}}
+	report, err := Run(context.Background(), Config{URL: "http://localhost:" + port, Requests: 10, Transport: transport, Hooks: []Hook{failAll}, Quiet: true})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if report.Status5xx != 5 || report.ExpectationFailures != 10 || report.FailedRequests != 10 {
+		t.Errorf("Expected each of the 10 requests to fail once, got %d 5xx, %d failed expectations and %d failed requests",
+			report.Status5xx, report.ExpectationFailures, report.FailedRequests)
+	}
+}
+
+func TestThatRequestsAreSentWithTheTransport(t *testing.T) {
+	var calls uint32
+	transport := TransportFunc(func(ctx context.Context, request *OutgoingRequest) (*Response, error) {
+		n := atomic.AddUint32(&calls, 1)
+		if request.Method != "POST" || request.Body != "ping" || request.Headers.Get("X-Test") != "yes" {
+			return nil, errors.New("unexpected request: " + request.Method + " " + request.URL)
+		}
+		switch n % 3 {
+		case 0:
+			return &Response{500, http.Header{}, nil}, nil
+		case 1:
+			return nil, errors.New("connection refused")
+		}
+		return &Response{200, http.Header{"Content-Type": {"text/plain"}}, []byte("pong")}, nil
+	})
+	config := Config{URL: "http://mock/", Method: "POST", Body: "ping", Headers: []string{"X-Test: yes"}, Concurrency: 3,
+		Requests: 30, Transport: transport, Quiet: true}
+	report, err := Run(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if calls != 30 || report.Status2xx != 10 || report.Status5xx != 10 || report.ConnectionErrors != 10 {
+		t.Errorf("Expected 10 responses of each kind out of 30, got %d 2xx, %d 5xx and %d connection errors out of %d",
+			report.Status2xx, report.Status5xx, report.ConnectionErrors, calls)
+	}
+	var output bytes.Buffer
+	report.Print(&output)
+	if report.CountsConnections || strings.Contains(output.String(), "Connections opened") {
+		t.Errorf("Expected the connections of the transport not to be counted, got %s", output.String())
+	}
+
+	config.HTTP2 = true
+	if _, err := Run(context.Background(), config); err == nil {
+		t.Errorf("Expected a transport combined with HTTP/2 to be rejected")
+	}
+}
+
+func TestThatScriptGeneratesRequestsAndChecksResponses(t *testing.T) {
+	fileContents := `
+def next_request(vu):
+    if vu.iteration > 5:
+        return None
+    n = shared.incr("sent")
+    vu.vars["last"] = n
+    return build_request(
+        "http://localhost:` + port + `/scripted/%d" % n,
+        method = "POST" if n % 2 else "PUT",
+        body = json.encode({"n": n}),
+        headers = {"X-Iteration": str(vu.iteration)},
+    )
+
+def check_response(response, vu):
+    metric("body_length", len(response.body))
+    if vu.iteration == 3 and vu.vars["last"] == 3:
+        return "third request rejected"
+    return response.status == 200
+`
+	fileDir := "test-resources/script.star"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	testHandler := startServer()
+	config := defaultConfig()
+	config.url = ""
+	config.script = fileDir
+	config.numberOfRequests = 10
+	baton := &Baton{configuration: config, result: *newResult()}
+	if err := baton.run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	time.Sleep(time.Duration(100) * time.Millisecond)
+
+	if noRequestsReceived := atomic.LoadUint32(&testHandler.noRequestsReceived); noRequestsReceived != 5 {
+		t.Errorf("Expected the script to stop after 5 requests, got %d", noRequestsReceived)
+	}
+	if testHandler.lastURIReceived != "http://localhost:"+port+"/scripted/5" || testHandler.lastMethodReceived != "POST" {
+		t.Errorf("Expected the last request to be POST /scripted/5, got %s %s", testHandler.lastMethodReceived, testHandler.lastURIReceived)
+	}
+	if testHandler.lastBodyReceived != hex.EncodeToString([]byte(`{"n":5}`)) || string(testHandler.lastHeadersReceived.Peek("X-Iteration")) != "5" {
+		t.Errorf("Expected the body and headers built by the script, got %s", testHandler.lastHeadersReceived.String())
+	}
+	if baton.result.httpResult.expectationFailures != 1 {
+		t.Errorf("Expected the script to reject 1 response, got %d", baton.result.httpResult.expectationFailures)
+	}
+	if len(baton.result.metrics) != 1 || baton.result.metrics[0].Count != 5 {
+		t.Errorf("Expected a metric recorded for every response, got %+v", baton.result.metrics)
+	}
+
+	if err := ioutil.WriteFile(fileDir, []byte("x = 1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write a required test case file: %v", err)
+	}
+	if _, err := loadScript(fileDir, newLogger(true)); err == nil {
+		t.Errorf("Expected an error for a script without entry points")
+	}
+}
+
+func TestThatTimeoutsAreCountedSeparately(t *testing.T) {
+	startScenarioServer()
+	for _, readTimeout := range []bool{false, true} {
+		config := defaultConfig()
+		config.url = "http://localhost:" + scenarioPort + "/slow"
+		config.numberOfRequests = 4
+		if readTimeout {
+			config.readTimeout = 100 * time.Millisecond
+		} else {
+			config.timeout = 100 * time.Millisecond
+		}
+		baton := &Baton{configuration: config, result: *newResult()}
+		start := time.Now()
+		baton.run(context.Background())
+
+		// Idempotent requests are retried up to 5 times after a read timeout
+		if elapsed := time.Since(start); !readTimeout && elapsed > time.Second || elapsed > 3*time.Second {
+			t.Errorf("Expected requests to be given up after 100ms, 4 requests took %s", elapsed)
+		}
+		if baton.result.httpResult.timeoutCount != 4 || baton.result.httpResult.connectionErrorCount != 0 {
+			t.Errorf("Expected 4 timeouts and no connection errors (read timeout %t), got %d and %d", readTimeout, baton.result.httpResult.timeoutCount, baton.result.httpResult.connectionErrorCount)
+		}
+		censored := baton.result.httpResult.censoredTimes
+		if len(censored) != 4 || minimum(censored) < 100 || len(baton.result.httpResult.responseTimes) != 0 {
+			t.Errorf("Expected the time waited to be kept apart from the response times, got %v and %v", censored, baton.result.httpResult.responseTimes)
+		}
+		var output bytes.Buffer
+		baton.result.printResults(&output)
+		if !strings.Contains(output.String(), "Responses censored at timeout:                      4") {
+			t.Errorf("Expected the censored responses to be reported, got %s", output.String())
+		}
+		if !strings.Contains(output.String(), fmt.Sprintf("Max response time (ms):                    %10s", ">= "+strconv.Itoa(maximum(censored)))) || !strings.Contains(output.String(), "100% : >= ") {
+			t.Errorf("Expected the time waited to be a lower bound of the max response time, got %s", output.String())
+		}
+		report := newReport(baton.result)
+		if !report.HasResponseTimes || report.MaxResponseTime < 100*time.Millisecond || report.MeasuredResponses != 0 {
+			t.Errorf("Expected the time waited to bound the reported response times, got %+v", report)
+		}
+	}
+}
+
+// writeCertificate issues a certificate signed by parent (or self-signed), writing it and its key as PEM files
+func writeCertificate(t *testing.T, name string, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate a key: %v", err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Failed to create a certificate: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal a key: %v", err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	if ioutil.WriteFile("test-resources/"+name+".pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644) != nil ||
+		ioutil.WriteFile("test-resources/"+name+"-key.pem", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600) != nil {
+		t.Fatalf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	return certificate, key
+}
+
+func TestThatClientCertificatesAreSent(t *testing.T) {
+	validity := func(serial int64, template x509.Certificate) *x509.Certificate {
+		template.SerialNumber = big.NewInt(serial)
+		template.NotBefore = time.Now().Add(-time.Hour)
+		template.NotAfter = time.Now().Add(time.Hour)
+		return &template
+	}
+	ca, caKey := writeCertificate(t, "ca", validity(1, x509.Certificate{Subject: pkix.Name{CommonName: "Baton CA"}, IsCA: true,
+		BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}), nil, nil)
+	writeCertificate(t, "server", validity(2, x509.Certificate{Subject: pkix.Name{CommonName: "baton.test"}, DNSNames: []string{"baton.test"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}), ca, caKey)
+	writeCertificate(t, "client", validity(3, x509.Certificate{Subject: pkix.Name{CommonName: "baton"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}), ca, caKey)
+	for _, name := range []string{"ca", "server", "client"} {
+		defer os.Remove("test-resources/" + name + ".pem")
+		defer os.Remove("test-resources/" + name + "-key.pem")
+	}
+
+	serverCertificate, err := tls.LoadX509KeyPair("test-resources/server.pem", "test-resources/server-key.pem")
+	if err != nil {
+		t.Fatalf("Failed to load the server certificate: %v", err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "baton" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCertificate}, ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs: clientCAs, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	for _, withCertificate := range []bool{true, false} {
+		config := defaultConfig()
+		config.url = server.URL
+		config.numberOfRequests = 3
+		config.caFile = "test-resources/ca.pem"
+		config.tlsServerName = "baton.test"
+		config.tlsMinVersion = "1.2"
+		if withCertificate {
+			config.clientCert = "test-resources/client.pem"
+			config.clientKey = "test-resources/client-key.pem"
+		}
+		baton := &Baton{configuration: config, result: *newResult()}
+		if err := baton.run(context.Background()); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		if withCertificate && baton.result.httpResult.status2xxCount != 3 {
+			t.Errorf("Expected 3 successful requests with a client certificate, got %d", baton.result.httpResult.status2xxCount)
+		}
+		if !withCertificate && baton.result.httpResult.connectionErrorCount != 3 {
+			t.Errorf("Expected 3 connection errors without a client certificate, got %d", baton.result.httpResult.connectionErrorCount)
+		}
+	}
+}
+
+func TestThatTLSOptionsAreValidated(t *testing.T) {
+	invalid := map[string]func(*Configuration){
+		"unknown version":      func(config *Configuration) { config.tlsMinVersion = "1.4" },
+		"min above max":        func(config *Configuration) { config.tlsMinVersion, config.tlsMaxVersion = "1.3", "1.2" },
+		"unknown cipher suite": func(config *Configuration) { config.tlsCipherSuites = "TLS_RSA_WITH_NOTHING" },
+		"certificate, no key":  func(config *Configuration) { config.clientCert = "client.pem" },
+		"key, no certificate":  func(config *Configuration) { config.clientKey = "client-key.pem" },
+	}
+	for name, change := range invalid {
+		config := defaultConfig()
+		change(&config)
+		if config.validate() == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+
+	config := defaultConfig()
+	config.clientCert = "client.p12"
+	config.tlsCipherSuites = "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"
+	if err := config.validate(); err != nil {
+		t.Errorf("Expected a PKCS#12 bundle and known cipher suites to be accepted, got %v", err)
+	}
+}
+
+func TestThatHandshakesAreMeasured(t *testing.T) {
+	var connections uint32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddUint32(&connections, 1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	for _, resume := range []bool{false, true} {
+		atomic.StoreUint32(&connections, 0)
+		config := defaultConfig()
+		config.url = server.URL
+		config.numberOfRequests = 5
+		config.ignoreTLS = true
+		config.tlsHandshake = true
+		config.tlsResume = resume
+		baton := &Baton{configuration: config, result: *newResult()}
+		if err := baton.run(context.Background()); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		handshakes := baton.result.httpResult.handshakeResult
+		if baton.result.httpResult.status2xxCount != 5 || atomic.LoadUint32(&connections) != 5 {
+			t.Errorf("Expected 5 requests over 5 connections, got %d over %d", baton.result.httpResult.status2xxCount, connections)
+		}
+		expectedFull := 5
+		if resume {
+			expectedFull = 1
+		}
+		if handshakes.full.count != expectedFull || handshakes.resumed.count != 5-expectedFull {
+			t.Errorf("Expected %d full handshakes with resumption %t, got %d full and %d resumed", expectedFull, resume, handshakes.full.count, handshakes.resumed.count)
+		}
+		if parameters := handshakes.sortedNegotiated(); len(parameters) != 1 || !strings.HasPrefix(parameters[0], "TLS 1.3, TLS_") || !strings.HasSuffix(parameters[0], ", http/1.1") {
+			t.Errorf("Expected TLS 1.3 with HTTP/1.1 to be negotiated, got %v", parameters)
+		}
+	}
+}
+
+func TestThatConnectionReuseIsControlled(t *testing.T) {
+	var connections uint32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddUint32(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	for _, test := range []struct {
+		disableKeepAlive bool
+		maxConnRequests  int
+		expected         int
+	}{{false, 0, 1}, {true, 0, 10}, {false, 3, 4}} {
+		atomic.StoreUint32(&connections, 0)
+		config := defaultConfig()
+		config.url = server.URL
+		config.numberOfRequests = 10
+		config.disableKeepAlive = test.disableKeepAlive
+		config.maxConnRequests = test.maxConnRequests
+		baton := &Baton{configuration: config, result: *newResult()}
+		if err := baton.run(context.Background()); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		if baton.result.httpResult.status2xxCount != 10 {
+			t.Errorf("Expected 10 successful requests, got %d", baton.result.httpResult.status2xxCount)
+		}
+		if baton.result.connectionsOpened != test.expected || int(atomic.LoadUint32(&connections)) != test.expected {
+			t.Errorf("Expected %d connections (keep-alive disabled %t, %d requests per connection), opened %d and received %d",
+				test.expected, test.disableKeepAlive, test.maxConnRequests, baton.result.connectionsOpened, connections)
+		}
+	}
+}
+
+func TestThatRequestsAreSentOverUnixSockets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "baton")
+	if err != nil {
+		t.Fatalf("Failed to create a directory for the socket: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	socket := dir + "/app.sock"
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", socket, err)
+	}
+
+	var connections, unexpected uint32
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "app.internal" || r.URL.Path != "/health" || r.URL.Query().Get("probe") != "1" {
+			atomic.AddUint32(&unexpected, 1)
+		}
+	})}
+	server.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddUint32(&connections, 1)
+		}
+	}
+	go server.Serve(listener)
+	defer server.Close()
+
+	for _, test := range []struct {
+		unixURL          bool
+		disableKeepAlive bool
+		expected         int
+	}{{false, false, 1}, {false, true, 10}, {true, false, 1}} {
+		atomic.StoreUint32(&connections, 0)
+		config := defaultConfig()
+		if test.unixURL {
+			config.url = "unix://" + socket + ":/health?probe=1"
+			config.headers = []string{"Host: app.internal"}
+		} else {
+			config.url = "http://app.internal/health?probe=1"
+			config.unixSocket = socket
+		}
+		config.numberOfRequests = 10
+		config.disableKeepAlive = test.disableKeepAlive
+		baton := &Baton{configuration: config, result: *newResult()}
+		if err := baton.run(context.Background()); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		if baton.result.httpResult.status2xxCount != 10 || unexpected != 0 {
+			t.Errorf("Expected 10 requests for /health?probe=1 at app.internal, got %d successful and %d unexpected",
+				baton.result.httpResult.status2xxCount, unexpected)
+		}
+		if baton.result.connectionsOpened != test.expected || int(atomic.LoadUint32(&connections)) != test.expected {
+			t.Errorf("Expected %d connections to the socket (keep-alive disabled %t), opened %d and received %d",
+				test.expected, test.disableKeepAlive, baton.result.connectionsOpened, connections)
+		}
+	}
+
+	config := defaultConfig()
+	config.url = "unix://" + socket + ":/health"
+	config.unixSocket = socket
+	baton := &Baton{configuration: config, result: *newResult()}
+	if err := baton.run(context.Background()); err == nil {
+		t.Errorf("Expected a unix socket given both in the URL and apart to be rejected")
+	}
+}
+
+func TestThatRequestsArePipelined(t *testing.T) {
+	var connections uint32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddUint32(&connections, 1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	config := defaultConfig()
+	config.url = server.URL
+	config.numberOfRequests = 100
+	config.concurrency = 8
+	config.pipeline = 4
+	config.pipelineConns = 2
+	baton := &Baton{configuration: config, result: *newResult()}
+	if err := baton.run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// The first response time of each virtual user is left out of the statistics
+	if baton.result.httpResult.status2xxCount != 100 || len(baton.result.httpResult.responseTimes) != 92 {
+		t.Errorf("Expected 100 successful requests and 92 response times, got %d and %d", baton.result.httpResult.status2xxCount, len(baton.result.httpResult.responseTimes))
+	}
+	if opened := atomic.LoadUint32(&connections); opened > 2 || baton.result.connectionsOpened != int(opened) {
+		t.Errorf("Expected requests to be pipelined over at most 2 connections, opened %d and received %d", baton.result.connectionsOpened, opened)
+	}
+
+	config.concurrency = 9
+	if config.validate() == nil {
+		t.Errorf("Expected an error for more virtual users than pipelined requests")
+	}
+}
+
+func TestThatPipelinedRequestsGetTheDefaultPort(t *testing.T) {
+	client := newPipelineClient(defaultConfig(), nil, new(uint64))
+	for url, expectedAddr := range map[string]string{
+		"http://localhost/items":       "localhost:80",
+		"https://example.com/items":    "example.com:443",
+		"http://localhost:8888/items":  "localhost:8888",
+		"https://[::1]/items":          "[::1]:443",
+		"https://[::1]:8443/items?a=1": "[::1]:8443",
+	} {
+		req := fasthttp.AcquireRequest()
+		req.SetRequestURI(url)
+		if addr := client.hostClient(req).Addr; addr != expectedAddr {
+			t.Errorf("Expected requests to %s to be pipelined to %s, got %s", url, expectedAddr, addr)
+		}
+		fasthttp.ReleaseRequest(req)
+	}
+}
+
+func TestThatRequestsAreSentOverHTTP2(t *testing.T) {
+	var connections, http1Requests uint32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			atomic.AddUint32(&http1Requests, 1)
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("Set-Cookie", "sid=h2; Path=/")
+	})
+	for _, useTLS := range []bool{true, false} {
+		atomic.StoreUint32(&connections, 0)
+		server := httptest.NewUnstartedServer(handler)
+		server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				atomic.AddUint32(&connections, 1)
+			}
+		}
+		server.Config.Protocols = new(http.Protocols)
+		server.Config.Protocols.SetHTTP2(true)
+		server.Config.Protocols.SetUnencryptedHTTP2(true)
+		if useTLS {
+			server.EnableHTTP2 = true
+			server.StartTLS()
+		} else {
+			server.Start()
+		}
+
+		config := defaultConfig()
+		config.url = server.URL
+		config.numberOfRequests = 40
+		config.concurrency = 8
+		config.ignoreTLS = true
+		config.http2 = true
+		config.http2Conns = 2
+		config.keepCookies = true
+		baton := &Baton{configuration: config, result: *newResult()}
+		if err := baton.run(context.Background()); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		server.Close()
+
+		if baton.result.httpResult.status2xxCount != 40 || atomic.LoadUint32(&http1Requests) != 0 {
+			t.Errorf("Expected 40 successful HTTP/2 requests (TLS %t), got %d with %d over HTTP/1", useTLS, baton.result.httpResult.status2xxCount, http1Requests)
+		}
+		if opened := atomic.LoadUint32(&connections); opened != 2 || baton.result.connectionsOpened != 2 {
+			t.Errorf("Expected 2 connections (TLS %t), opened %d and received %d", useTLS, baton.result.connectionsOpened, opened)
+		}
+		if baton.result.maxStreams < 2 || baton.result.maxStreams > 4 {
+			t.Errorf("Expected up to 4 concurrent streams per connection, got %d", baton.result.maxStreams)
+		}
+	}
+}
+
+func TestThatHTTP2StreamsAreLimited(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	config := defaultConfig()
+	config.url = server.URL
+	config.numberOfRequests = 40
+	config.concurrency = 8
+	config.http2 = true
+	config.http2Conns = 1
+	config.http2Streams = 2
+	baton := &Baton{configuration: config, result: *newResult()}
+	if err := baton.run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if baton.result.httpResult.status2xxCount != 40 || baton.result.maxStreams != 2 {
+		t.Errorf("Expected 40 successful requests over at most 2 streams, got %d over %d", baton.result.httpResult.status2xxCount, baton.result.maxStreams)
+	}
+}
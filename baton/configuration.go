@@ -0,0 +1,239 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Configuration represents the Baton configuration
+type Configuration struct {
+	body               string
+	caFile             string
+	clientCert         string
+	clientCertPassword string
+	clientKey          string
+	concurrency        int
+	dataFilePath       string
+	dataFiles          string
+	dataMode           string
+	dialTimeout        time.Duration
+	disableKeepAlive   bool
+	duration           time.Duration
+	harContentTypes    string
+	harDomains         string
+	headers            []string
+	hooks              []Hook
+	http2              bool
+	http2Conns         int
+	http2Streams       int
+	idleTimeout        time.Duration
+	ignoreTLS          bool
+	keepCookies        bool
+	keepTiming         bool
+	logPattern         string
+	logTarget          string
+	maxConnRequests    int
+	maxConnsPerHost    int
+	method             string
+	numberOfRequests   int
+	openAPIExcludeTags string
+	openAPIServer      string
+	openAPITags        string
+	pacing             time.Duration
+	pipeline           int
+	pipelineConns      int
+	postmanEnvironment string
+	readTimeout        time.Duration
+	replaySpeed        float64
+	requestsFromFile   string
+	requestsFormat     string
+	requestOrder       string
+	scenarioFile       string
+	script             string
+	source             RequestSource
+	suppressOutput     bool
+	templateRequests   bool
+	thinkTime          string
+	timeout            time.Duration
+	tlsCipherSuites    string
+	tlsHandshake       bool
+	tlsMaxVersion      string
+	tlsMinVersion      string
+	tlsResume          bool
+	tlsServerName      string
+	transport          Transport
+	unixSocket         string
+	url                string
+	vuConnections      bool
+	wait               time.Duration
+	writeTimeout       time.Duration
+}
+
+// connLimit returns the number of requests after which a virtual user closes its connection, 0 for no limit
+func (configuration *Configuration) connLimit() int {
+	if configuration.disableKeepAlive {
+		return 1
+	}
+	return configuration.maxConnRequests
+}
+
+// useUnixURL maps a unix:// URL onto the unix socket the dialer connects to and a plain http URL, whose host is the one
+// given with a Host header, which is moved into the URL, or localhost
+func (configuration *Configuration) useUnixURL() error {
+	socket, requestURI, ok := parseUnixURL(configuration.url)
+	if !ok {
+		return nil
+	}
+	if socket == "" {
+		return errors.New("missing path of the unix socket in URL: " + configuration.url)
+	}
+	if configuration.unixSocket != "" {
+		return errors.New("a unix socket cannot be given both in the URL and apart")
+	}
+	host := "localhost"
+	var headers []string
+	for _, header := range configuration.headers {
+		if name, value, found := strings.Cut(header, ":"); found && strings.EqualFold(strings.TrimSpace(name), "Host") {
+			host = strings.TrimSpace(value)
+		} else {
+			headers = append(headers, header)
+		}
+	}
+	configuration.headers = headers
+	configuration.unixSocket = socket
+	configuration.url = "http://" + host + requestURI
+	return nil
+}
+
+func (configuration *Configuration) validate() error {
+
+	if configuration.concurrency < 1 || configuration.numberOfRequests < 0 {
+		return errors.New("invalid concurrency level or number of requests")
+	}
+
+	switch configuration.dataMode {
+	case "", sequentialData, randomData, uniqueData, vuData:
+	default:
+		return errors.New("invalid data mode: " + configuration.dataMode)
+	}
+
+	switch configuration.requestOrder {
+	case "", randomOrder, sequentialOrder, loopOrder, partitionOrder:
+	default:
+		return errors.New("invalid request order: " + configuration.requestOrder)
+	}
+
+	if configuration.replaySpeed <= 0 {
+		return errors.New("invalid replay speed, must be greater than 0")
+	}
+
+	switch configuration.requestsFormat {
+	case "", csvFormat, jsonlFormat, harFormat, curlFormat, openAPIFormat, postmanFormat, accessLogFormat:
+	default:
+		return errors.New("invalid requests file format: " + configuration.requestsFormat)
+	}
+
+	if configuration.timeout < 0 || configuration.dialTimeout < 0 || configuration.readTimeout < 0 || configuration.writeTimeout < 0 || configuration.idleTimeout < 0 {
+		return errors.New("invalid timeout, must not be negative")
+	}
+
+	if configuration.maxConnsPerHost < 0 || configuration.maxConnRequests < 0 {
+		return errors.New("invalid connection limit, must not be negative")
+	}
+	if configuration.maxConnsPerHost > 0 && (configuration.vuConnections || configuration.maxConnRequests > 1) {
+		return errors.New("a maximum number of connections cannot be used when each virtual user has its own connection")
+	}
+
+	if configuration.pipeline < 0 || configuration.pipelineConns < 0 {
+		return errors.New("invalid pipelining, the number of requests and of connections must not be negative")
+	}
+	if configuration.pipeline > 0 {
+		if configuration.disableKeepAlive || configuration.maxConnRequests > 0 || configuration.vuConnections || configuration.tlsHandshake {
+			return errors.New("pipelined connections are shared, so they cannot be closed after some requests or kept per virtual user")
+		}
+		if configuration.concurrency > configuration.pipeline*configuration.pipelineConns {
+			return errors.New("invalid pipelining, the concurrency must not exceed the pipelined requests of all the connections")
+		}
+	}
+
+	if configuration.http2Conns < 0 || configuration.http2Streams < 0 {
+		return errors.New("invalid number of HTTP/2 connections or streams, must not be negative")
+	}
+	if configuration.http2 && (configuration.pipeline > 0 || configuration.tlsHandshake) {
+		return errors.New("HTTP/2 cannot be combined with pipelining or the TLS handshake mode")
+	}
+	if configuration.http2 && (configuration.disableKeepAlive || configuration.maxConnRequests > 0 || configuration.vuConnections) {
+		return errors.New("HTTP/2 connections are shared, so they cannot be closed after some requests or kept per virtual user")
+	}
+
+	if configuration.transport != nil && (configuration.http2 || configuration.pipeline > 0 || configuration.tlsHandshake) {
+		return errors.New("a transport cannot be combined with HTTP/2, pipelining or the TLS handshake mode")
+	}
+	if configuration.transport != nil && (configuration.disableKeepAlive || configuration.maxConnRequests > 0 || configuration.vuConnections) {
+		return errors.New("the connections of a transport are its own, so they cannot be closed after some requests or kept per virtual user")
+	}
+
+	if configuration.pacing < 0 {
+		return errors.New("invalid pacing, must not be negative")
+	}
+	if _, err := parseThinkTime(configuration.thinkTime); err != nil {
+		return errors.New("invalid think time: " + err.Error())
+	}
+
+	if configuration.clientCert == "" && configuration.clientKey != "" {
+		return errors.New("a client key cannot be used without a client certificate")
+	}
+	if configuration.clientCert != "" && configuration.clientKey == "" && !isPKCS12(configuration.clientCert) {
+		return errors.New("a client certificate in PEM format needs a client key")
+	}
+	minVersion, err := parseTLSVersion(configuration.tlsMinVersion)
+	if err != nil {
+		return err
+	}
+	maxVersion, err := parseTLSVersion(configuration.tlsMaxVersion)
+	if err != nil {
+		return err
+	}
+	if minVersion != 0 && maxVersion != 0 && minVersion > maxVersion {
+		return errors.New("invalid TLS versions, the minimum is above the maximum")
+	}
+	if _, err := parseCipherSuites(configuration.tlsCipherSuites); err != nil {
+		return err
+	}
+
+	if configuration.tlsResume && !configuration.tlsHandshake {
+		return errors.New("TLS session resumption can only be measured in TLS handshake mode")
+	}
+	if configuration.tlsHandshake && strings.HasPrefix(configuration.url, "http://") {
+		return errors.New("TLS handshake mode needs an https URL")
+	}
+	if configuration.unixSocket != "" && configuration.transport != nil {
+		return errors.New("a unix socket cannot be used with a custom transport, which opens its own connections")
+	}
+
+	if configuration.scenarioFile != "" && configuration.requestsFromFile != "" {
+		return errors.New("a scenario and a requests file cannot be used together")
+	}
+	if configuration.source != nil && (configuration.scenarioFile != "" || configuration.requestsFromFile != "") {
+		return errors.New("a request source cannot be used together with a scenario or a requests file")
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"context"
+	"time"
+)
+
+// CountWorker implements a worker which sends a fixed number of requests
+type countWorker struct {
+	*worker
+	timings chan int
+}
+
+func newCountWorker(ctx context.Context, id int, requests <-chan bool, results chan<- HTTPResult, done chan<- bool) *countWorker {
+	worker := newWorker(ctx, id, requests, results, done)
+	timings := make(chan int, len(requests))
+	return &countWorker{worker, timings}
+}
+
+func (worker *countWorker) sendRequest(request preLoadedRequest) {
+	var req *OutgoingRequest
+
+	for range worker.requests {
+		if worker.stopped() {
+			break
+		}
+		iterationStart := time.Now()
+		// The same request is sent over and over, unless it has to be built again every time
+		if req == nil || !worker.reusable(request) {
+			var ok bool
+			if req, ok = worker.buildRequest(request); !ok {
+				break
+			}
+		}
+		if req == nil {
+			worker.pace(iterationStart)
+			continue
+		}
+		if resp, failed := worker.performRequestWithStats(req, worker.timings); !failed {
+			worker.checkResponse(nil, req, resp)
+		}
+		worker.pace(iterationStart)
+	}
+
+	worker.collectStatistics(worker.timings)
+	worker.finish()
+}
+
+func (worker *countWorker) sendRequests(requests []preLoadedRequest, selector requestSelector) {
+	for range worker.requests {
+		if worker.stopped() {
+			break
+		}
+		iterationStart := time.Now()
+		request, ok := worker.nextRequest(requests, selector)
+		if !ok {
+			break
+		}
+		req, ok := worker.buildRequest(request)
+		if !ok {
+			break
+		}
+		if req == nil {
+			worker.pace(iterationStart)
+			continue
+		}
+		if resp, failed := worker.performRequestWithStats(req, worker.timings); !failed {
+			worker.checkResponse(request.expect, req, resp)
+		}
+		worker.pace(iterationStart)
+	}
+
+	worker.collectStatistics(worker.timings)
+	worker.finish()
+}
+
+func (worker *countWorker) sendScenario(scenario *scenario) {
+	// Every iteration of the scenario sends a request for each of its steps
+	timings := make(chan int, cap(worker.requests)*len(scenario.steps))
+
+	for range worker.requests {
+		if worker.stopped() {
+			break
+		}
+		iterationStart := time.Now()
+		if !worker.runScenario(scenario, timings) {
+			break
+		}
+		worker.pace(iterationStart)
+	}
+
+	worker.collectStatistics(timings)
+	worker.finish()
+}
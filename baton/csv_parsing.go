@@ -14,7 +14,7 @@
  * permissions and limitations under the License.
  */
 
-package main
+package baton
 
 import (
 	"bufio"
@@ -22,23 +22,25 @@ import (
 	"errors"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 )
 
 func extractHeaders(rawHeaders string) []string {
-	headerParts := strings.Split(rawHeaders, ":")
+	headerParts := strings.SplitN(rawHeaders, ":", 2)
 	if len(headerParts) == 2 {
 		return []string{headerParts[0], headerParts[1]}
 	}
 	return nil
 }
 
-func preLoadRequestsFromFile(filename string) ([]preLoadedRequest, error) {
+func preLoadRequestsFromCSVFile(filename string) ([]preLoadedRequest, error) {
 	file, err := os.Open(filename)
 
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
 	reader := csv.NewReader(bufio.NewReader(file))
 	var requests []preLoadedRequest
@@ -56,6 +58,7 @@ func preLoadRequestsFromFile(filename string) ([]preLoadedRequest, error) {
 		var url = ""
 		var body = ""
 		var headers [][]string
+		var weight = 1
 		noFields := len(record)
 
 		if noFields < 2 {
@@ -71,8 +74,20 @@ func preLoadRequestsFromFile(filename string) ([]preLoadedRequest, error) {
 			body = record[2]
 		}
 
+		headersStart := 3
 		if noFields >= 4 {
-			for i := 3; i < noFields; i++ {
+			// An optional numeric weight may precede the headers
+			if parsedWeight, err := strconv.Atoi(strings.TrimSpace(record[3])); err == nil {
+				if parsedWeight < 1 {
+					return nil, errors.New("invalid weight, must be a positive integer")
+				}
+				weight = parsedWeight
+				headersStart = 4
+			}
+		}
+
+		if noFields > headersStart {
+			for i := headersStart; i < noFields; i++ {
 				extractedHeaders := extractHeaders(record[i])
 				if extractedHeaders != nil {
 					headers = append(headers, extractedHeaders)
@@ -80,7 +95,7 @@ func preLoadRequestsFromFile(filename string) ([]preLoadedRequest, error) {
 			}
 		}
 
-		requests = append(requests, preLoadedRequest{method, url, body, headers})
+		requests = append(requests, preLoadedRequest{method: method, url: url, body: body, headers: headers, weight: weight})
 	}
 
 	return requests, nil
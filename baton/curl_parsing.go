@@ -0,0 +1,354 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	neturl "net/url"
+	"strings"
+)
+
+// Options of curl which take an argument but have no effect on the request sent by Baton
+var ignoredCurlOptionsWithArgument = map[string]bool{
+	"--alt-svc": true, "--cacert": true, "--capath": true, "-E": true, "--cert": true, "--cert-type": true,
+	"--ciphers": true, "--connect-timeout": true, "--connect-to": true, "-C": true, "--continue-at": true,
+	"-c": true, "--cookie-jar": true, "--create-file-mode": true, "--crlfile": true, "--curves": true,
+	"--delegation": true, "--dns-interface": true, "--dns-ipv4-addr": true, "--dns-ipv6-addr": true,
+	"--dns-servers": true, "--doh-url": true, "-D": true, "--dump-header": true, "--egd-file": true,
+	"--engine": true, "--etag-compare": true, "--etag-save": true, "--expect100-timeout": true,
+	"--happy-eyeballs-timeout-ms": true, "--hsts": true, "--interface": true, "--ip-tos": true,
+	"--keepalive-time": true, "--key": true, "--key-type": true, "--krb": true, "--libcurl": true,
+	"--limit-rate": true, "--local-port": true, "--max-filesize": true, "--max-redirs": true, "-m": true,
+	"--max-time": true, "--netrc-file": true, "--noproxy": true, "-o": true, "--output": true,
+	"--output-dir": true, "--parallel-max": true, "--pass": true, "--pinnedpubkey": true, "--preproxy": true,
+	"--proto": true, "--proto-default": true, "--proto-redir": true, "-x": true, "--proxy": true,
+	"--proxy-cacert": true, "--proxy-capath": true, "--proxy-cert": true, "--proxy-cert-type": true,
+	"--proxy-ciphers": true, "--proxy-crlfile": true, "--proxy-header": true, "--proxy-key": true,
+	"--proxy-key-type": true, "--proxy-pass": true, "--proxy-pinnedpubkey": true, "--proxy-service-name": true,
+	"--proxy-tls13-ciphers": true, "--proxy-tlsauthtype": true, "--proxy-tlspassword": true,
+	"--proxy-tlsuser": true, "-U": true, "--proxy-user": true, "--proxy1.0": true, "--random-file": true,
+	"--rate": true, "--resolve": true, "--retry": true, "--retry-delay": true, "--retry-max-time": true,
+	"--service-name": true, "--socks4": true, "--socks4a": true, "--socks5": true,
+	"--socks5-gssapi-service": true, "--socks5-hostname": true, "-Y": true, "--speed-limit": true, "-y": true,
+	"--speed-time": true, "--stderr": true, "--tls-max": true, "--tls13-ciphers": true, "--tlsauthtype": true,
+	"--tlspassword": true, "--tlsuser": true, "--trace": true, "--trace-ascii": true, "-w": true,
+	"--write-out": true,
+}
+
+// Options of curl which take an argument and change the request in a way Baton does not support
+var unsupportedCurlOptionsWithArgument = map[string]bool{
+	"-K": true, "--config": true, "--form-string": true, "--json": true, "--oauth2-bearer": true, "-r": true,
+	"--range": true, "--request-target": true, "-T": true, "--upload-file": true, "--unix-socket": true,
+	"--abstract-unix-socket": true, "--url-query": true, "--variable": true, "-z": true, "--time-cond": true,
+}
+
+// splitCurlCommands splits the contents of a file into commands, joining lines ending with a backslash
+func splitCurlCommands(contents string) []string {
+	contents = strings.Replace(contents, "\r\n", "\n", -1)
+	contents = strings.Replace(contents, "\\\n", " ", -1)
+
+	var commands []string
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		commands = append(commands, line)
+	}
+	return commands
+}
+
+// tokenizeCurlCommand splits a command line into arguments the way a POSIX shell would
+func tokenizeCurlCommand(command string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		case c == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote")
+			}
+			current.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case c == '$' && i+1 < len(command) && command[i+1] == '\'':
+			// ANSI-C quoting, as produced by some browsers when copying as cURL
+			i += 2
+			for ; i < len(command) && command[i] != '\''; i++ {
+				if command[i] == '\\' && i+1 < len(command) {
+					i++
+					current.WriteString(unescapeCurlCharacter(command[i]))
+					continue
+				}
+				current.WriteByte(command[i])
+			}
+			if i >= len(command) {
+				return nil, errors.New("unterminated single quote")
+			}
+			inArg = true
+		case c == '"':
+			i++
+			for ; i < len(command) && command[i] != '"'; i++ {
+				if command[i] == '\\' && i+1 < len(command) && strings.IndexByte("\"\\$`", command[i+1]) >= 0 {
+					i++
+				}
+				current.WriteByte(command[i])
+			}
+			if i >= len(command) {
+				return nil, errors.New("unterminated double quote")
+			}
+			inArg = true
+		case c == '\\' && i+1 < len(command):
+			i++
+			current.WriteByte(command[i])
+			inArg = true
+		default:
+			current.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+func unescapeCurlCharacter(c byte) string {
+	switch c {
+	case 'n':
+		return "\n"
+	case 'r':
+		return "\r"
+	case 't':
+		return "\t"
+	default:
+		return string(c)
+	}
+}
+
+// readCurlData resolves a data argument, loading it from a file when it starts with @
+func readCurlData(data string, stripNewlines bool) (string, error) {
+	if !strings.HasPrefix(data, "@") {
+		return data, nil
+	}
+	contents, err := ioutil.ReadFile(data[1:])
+	if err != nil {
+		return "", err
+	}
+	if stripNewlines {
+		return strings.NewReplacer("\r", "", "\n", "").Replace(string(contents)), nil
+	}
+	return string(contents), nil
+}
+
+func parseCurlCommand(args []string) (preLoadedRequest, error) {
+	if len(args) == 0 || args[0] != "curl" {
+		return preLoadedRequest{}, errors.New("not a curl command")
+	}
+
+	method, url := "", ""
+	var headers [][]string
+	var data []string
+	get, compressed := false, false
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		option, value, hasValue := arg, "", false
+
+		// Short options may have their value attached, e.g. -XPOST
+		if len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && (strings.IndexByte("XHdubAe", arg[1]) >= 0 ||
+			ignoredCurlOptionsWithArgument[arg[:2]] || unsupportedCurlOptionsWithArgument[arg[:2]]) {
+			option, value, hasValue = arg[:2], arg[2:], true
+		} else if strings.HasPrefix(arg, "--") && strings.Contains(arg, "=") {
+			parts := strings.SplitN(arg, "=", 2)
+			option, value, hasValue = parts[0], parts[1], true
+		}
+
+		nextValue := func() (string, error) {
+			if hasValue {
+				return value, nil
+			}
+			if i+1 >= len(args) {
+				return "", errors.New("missing value for " + option)
+			}
+			i++
+			return args[i], nil
+		}
+
+		var err error
+		switch option {
+		case "-X", "--request":
+			method, err = nextValue()
+		case "-H", "--header":
+			var header string
+			if header, err = nextValue(); err == nil {
+				if extractedHeader := extractHeaders(header); extractedHeader != nil {
+					headers = append(headers, []string{strings.TrimSpace(extractedHeader[0]), strings.TrimSpace(extractedHeader[1])})
+				}
+			}
+		case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw", "--data-urlencode":
+			var rawData string
+			if rawData, err = nextValue(); err != nil {
+				break
+			}
+			switch option {
+			case "--data-raw":
+			case "--data-urlencode":
+				rawData, err = urlEncodeCurlData(rawData)
+			default:
+				rawData, err = readCurlData(rawData, option != "--data-binary")
+			}
+			data = append(data, rawData)
+		case "-u", "--user":
+			var credentials string
+			if credentials, err = nextValue(); err == nil {
+				headers = append(headers, []string{"Authorization", "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))})
+			}
+		case "-b", "--cookie":
+			var cookie string
+			if cookie, err = nextValue(); err == nil {
+				headers = append(headers, []string{"Cookie", cookie})
+			}
+		case "-A", "--user-agent":
+			var userAgent string
+			if userAgent, err = nextValue(); err == nil {
+				headers = append(headers, []string{"User-Agent", userAgent})
+			}
+		case "-e", "--referer":
+			var referer string
+			if referer, err = nextValue(); err == nil {
+				headers = append(headers, []string{"Referer", referer})
+			}
+		case "--url":
+			url, err = nextValue()
+		case "--compressed":
+			compressed = true
+		case "-G", "--get":
+			get = true
+		case "-I", "--head":
+			method = "HEAD"
+		case "-F", "--form":
+			return preLoadedRequest{}, errors.New("multipart form data (" + option + ") is not supported")
+		default:
+			if ignoredCurlOptionsWithArgument[option] {
+				_, err = nextValue()
+			} else if unsupportedCurlOptionsWithArgument[option] {
+				return preLoadedRequest{}, errors.New("unsupported option: " + option)
+			} else if !strings.HasPrefix(arg, "-") {
+				url = arg
+			}
+		}
+		if err != nil {
+			return preLoadedRequest{}, err
+		}
+	}
+
+	if url == "" {
+		return preLoadedRequest{}, errors.New("no URL found")
+	}
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+
+	body := strings.Join(data, "&")
+	if get && body != "" {
+		separator := "?"
+		if strings.Contains(url, "?") {
+			separator = "&"
+		}
+		url, body = url+separator+body, ""
+	}
+
+	if method == "" {
+		method = "GET"
+		if body != "" {
+			method = "POST"
+		}
+	}
+
+	if body != "" && !hasHeader(headers, "Content-Type") {
+		headers = append(headers, []string{"Content-Type", "application/x-www-form-urlencoded"})
+	}
+	if compressed && !hasHeader(headers, "Accept-Encoding") {
+		headers = append(headers, []string{"Accept-Encoding", "deflate, gzip"})
+	}
+
+	return preLoadedRequest{method: method, url: url, body: body, headers: headers, weight: 1}, nil
+}
+
+func urlEncodeCurlData(data string) (string, error) {
+	name, content := "", data
+	if index := strings.IndexAny(data, "=@"); index >= 0 {
+		name, content = data[:index], data[index+1:]
+		if data[index] == '@' {
+			contents, err := ioutil.ReadFile(content)
+			if err != nil {
+				return "", err
+			}
+			content = string(contents)
+		}
+	}
+	if name == "" {
+		return neturl.QueryEscape(content), nil
+	}
+	return name + "=" + neturl.QueryEscape(content), nil
+}
+
+func hasHeader(headers [][]string, name string) bool {
+	for _, header := range headers {
+		if strings.EqualFold(header[0], name) {
+			return true
+		}
+	}
+	return false
+}
+
+func preLoadRequestsFromCurlFile(filename string) ([]preLoadedRequest, error) {
+	contents, err := ioutil.ReadFile(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var requests []preLoadedRequest
+	for i, command := range splitCurlCommands(string(contents)) {
+		args, err := tokenizeCurlCommand(command)
+		if err != nil {
+			return nil, fmt.Errorf("command %d: %v", i+1, err)
+		}
+		request, err := parseCurlCommand(args)
+		if err != nil {
+			return nil, fmt.Errorf("command %d: %v", i+1, err)
+		}
+		requests = append(requests, request)
+	}
+
+	return requests, nil
+}
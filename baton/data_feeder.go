@@ -0,0 +1,172 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	sequentialData = "sequential"
+	randomData     = "random"
+	uniqueData     = "unique"
+	vuData         = "vu"
+)
+
+// dataFeeder hands out the rows of a data file to be used as template variables
+type dataFeeder struct {
+	rows   []map[string]string
+	mode   string
+	cursor *uint64
+}
+
+func newDataFeeder(filename string, mode string) (*dataFeeder, error) {
+	var rows []map[string]string
+	var err error
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		rows, err = loadJSONData(filename, false)
+	case ".jsonl", ".ndjson":
+		rows, err = loadJSONData(filename, true)
+	default:
+		rows, err = loadCSVData(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("no rows found in data file: " + filename)
+	}
+
+	return &dataFeeder{rows, mode, new(uint64)}, nil
+}
+
+// loadCSVData reads a CSV file whose first row names the columns
+func loadCSVData(filename string) ([]map[string]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(bufio.NewReader(file))
+	columns, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []map[string]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			row[strings.TrimSpace(column)] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// loadJSONData reads either a JSON array of objects or one object per line
+func loadJSONData(filename string, lines bool) ([]map[string]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var objects []map[string]interface{}
+	decoder := json.NewDecoder(file)
+	if !lines {
+		if err := decoder.Decode(&objects); err != nil {
+			return nil, err
+		}
+	} else {
+		for decoder.More() {
+			var object map[string]interface{}
+			if err := decoder.Decode(&object); err != nil {
+				return nil, err
+			}
+			objects = append(objects, object)
+		}
+	}
+
+	rows := make([]map[string]string, len(objects))
+	for i, object := range objects {
+		rows[i] = make(map[string]string, len(object))
+		for key, value := range object {
+			if text, ok := value.(string); ok {
+				rows[i][key] = text
+				continue
+			}
+			encoded, _ := json.Marshal(value)
+			rows[i][key] = string(encoded)
+		}
+	}
+	return rows, nil
+}
+
+// next returns the row to be used by a worker for its next request, or false once the rows have run out
+func (feeder *dataFeeder) next(workerID int) (map[string]string, bool) {
+	switch feeder.mode {
+	case randomData:
+		return feeder.rows[rand.Intn(len(feeder.rows))], true
+	case uniqueData:
+		index := atomic.AddUint64(feeder.cursor, 1) - 1
+		if index >= uint64(len(feeder.rows)) {
+			return nil, false
+		}
+		return feeder.rows[index], true
+	case vuData:
+		return feeder.rows[(workerID-1)%len(feeder.rows)], true
+	default:
+		index := atomic.AddUint64(feeder.cursor, 1) - 1
+		return feeder.rows[index%uint64(len(feeder.rows))], true
+	}
+}
+
+func loadDataFeeders(filenames []string, mode string, workers int) ([]*dataFeeder, error) {
+	var feeders []*dataFeeder
+	for _, filename := range filenames {
+		feeder, err := newDataFeeder(filename, mode)
+		if err != nil {
+			return nil, err
+		}
+		if mode == vuData && len(feeder.rows) < workers {
+			return nil, fmt.Errorf("data file %s has %d rows, which is not enough for %d virtual users", filename, len(feeder.rows), workers)
+		}
+		feeders = append(feeders, feeder)
+	}
+	return feeders, nil
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"github.com/valyala/fasthttp"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const unixScheme = "unix://"
+
+// parseUnixURL splits a URL such as unix:///var/run/app.sock:/health?verbose=1 into the path of the socket and the
+// URI of the request, which is / when the URL is only made of the socket
+func parseUnixURL(url string) (socket string, requestURI string, ok bool) {
+	if !strings.HasPrefix(url, unixScheme) {
+		return "", "", false
+	}
+	socket = url[len(unixScheme):]
+	requestURI = "/"
+	if i := strings.Index(socket, ":/"); i >= 0 {
+		socket, requestURI = socket[:i], socket[i+1:]
+	}
+	return socket, requestURI, true
+}
+
+// timeoutConn is a connection which gives up reading or writing after a time
+type timeoutConn struct {
+	net.Conn
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	readTimedOut *uint32
+}
+
+func (conn *timeoutConn) Read(b []byte) (int, error) {
+	if conn.readTimeout > 0 {
+		if err := conn.Conn.SetReadDeadline(time.Now().Add(conn.readTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	n, err := conn.Conn.Read(b)
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() && conn.readTimedOut != nil {
+		atomic.StoreUint32(conn.readTimedOut, 1)
+	}
+	return n, err
+}
+
+func (conn *timeoutConn) Write(b []byte) (int, error) {
+	if conn.writeTimeout > 0 {
+		if err := conn.Conn.SetWriteDeadline(time.Now().Add(conn.writeTimeout)); err != nil {
+			return 0, err
+		}
+	}
+	return conn.Conn.Write(b)
+}
+
+// newDialFunc returns the function the client opens connections with, counting them in opened. When a read on one of
+// the connections times out, readTimedOut is set to 1 if it is not nil. With a unix socket, every connection is opened
+// to the socket, whatever the host of the request, which is still the one sent in its Host header.
+func newDialFunc(configuration Configuration, opened *uint64, readTimedOut *uint32) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		var conn net.Conn
+		var err error
+		if configuration.unixSocket != "" {
+			conn, err = net.DialTimeout("unix", configuration.unixSocket, configuration.dialTimeout)
+		} else if configuration.dialTimeout > 0 {
+			conn, err = fasthttp.DialTimeout(addr, configuration.dialTimeout)
+		} else {
+			conn, err = fasthttp.Dial(addr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		atomic.AddUint64(opened, 1)
+		// The deadlines are set on the connection itself, as the read and write timeouts of the client are only
+		// as precise as its coarse clock, which ticks every second
+		if configuration.readTimeout > 0 || configuration.writeTimeout > 0 {
+			conn = &timeoutConn{conn, configuration.readTimeout, configuration.writeTimeout, readTimedOut}
+		}
+		return conn, nil
+	}
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import "bytes"
+
+// responseExpectation describes what a response to a pre-loaded request should look like
+type responseExpectation struct {
+	status       int        // The expected status code (ignored if 0)
+	bodyContains string     // A string the response body should contain (ignored if empty)
+	headers      [][]string // Array of two-element key/value pairs of headers the response should have
+}
+
+func (expectation *responseExpectation) matches(resp *Response) bool {
+	if expectation.status != 0 && resp.StatusCode != expectation.status {
+		return false
+	}
+	if expectation.bodyContains != "" && !bytes.Contains(resp.Body, []byte(expectation.bodyContains)) {
+		return false
+	}
+	for i := 0; i < len(expectation.headers); i++ {
+		if resp.Headers.Get(expectation.headers[i][0]) != expectation.headers[i][1] {
+			return false
+		}
+	}
+	return true
+}
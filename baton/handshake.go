@@ -0,0 +1,192 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/valyala/fasthttp"
+	"net"
+	"sort"
+	"time"
+)
+
+// handshakeResult holds the statistics of the TLS handshakes made in handshake mode
+type handshakeResult struct {
+	full       timedCounter
+	resumed    timedCounter
+	failures   int
+	negotiated map[string]int
+}
+
+// HandshakeStats sums up the TLS handshakes of one kind
+type HandshakeStats struct {
+	Count   int
+	Average time.Duration
+	Min     time.Duration
+	Max     time.Duration
+}
+
+func newHandshakeStats(counter timedCounter) HandshakeStats {
+	return HandshakeStats{counter.count, counter.averageTime(), counter.minTime, counter.maxTime}
+}
+
+func (result *handshakeResult) merge(other handshakeResult) {
+	result.full.merge(other.full)
+	result.resumed.merge(other.resumed)
+	result.failures += other.failures
+	for parameters, count := range other.negotiated {
+		if result.negotiated == nil {
+			result.negotiated = make(map[string]int)
+		}
+		result.negotiated[parameters] += count
+	}
+}
+
+func (result *handshakeResult) record(elapsed time.Duration, state tls.ConnectionState) {
+	if state.DidResume {
+		result.resumed.record(elapsed, false)
+	} else {
+		result.full.record(elapsed, false)
+	}
+	if result.negotiated == nil {
+		result.negotiated = make(map[string]int)
+	}
+	result.negotiated[negotiatedParameters(state)]++
+}
+
+// negotiatedParameters describes the version, cipher suite and application protocol of a TLS connection
+func negotiatedParameters(state tls.ConnectionState) string {
+	version := "unknown version"
+	for name, value := range tlsVersions {
+		if value == state.Version {
+			version = "TLS " + name
+		}
+	}
+	protocol := state.NegotiatedProtocol
+	if protocol == "" {
+		protocol = "no ALPN"
+	}
+	return version + ", " + tls.CipherSuiteName(state.CipherSuite) + ", " + protocol
+}
+
+// sortedNegotiated returns the negotiated parameters seen, the most frequent first
+func (result handshakeResult) sortedNegotiated() []string {
+	parameters := make([]string, 0, len(result.negotiated))
+	for description := range result.negotiated {
+		parameters = append(parameters, description)
+	}
+	sort.Slice(parameters, func(i, j int) bool {
+		if result.negotiated[parameters[i]] != result.negotiated[parameters[j]] {
+			return result.negotiated[parameters[i]] > result.negotiated[parameters[j]]
+		}
+		return parameters[i] < parameters[j]
+	})
+	return parameters
+}
+
+// handshaker is the transport of a virtual user in handshake mode, which opens a new connection for every request and
+// records its TLS handshake
+type handshaker struct {
+	tlsConfig *tls.Config
+	dial      fasthttp.DialFunc
+	result    handshakeResult
+}
+
+// newHandshaker returns the handshaker of a virtual user. Sessions are only cached, and so resumed, when resumption is
+// enabled, each virtual user keeping its own sessions.
+func newHandshaker(configuration Configuration, tlsConfig *tls.Config, opened *uint64) *handshaker {
+	handshakeConfig := &tls.Config{}
+	if tlsConfig != nil {
+		handshakeConfig = tlsConfig.Clone()
+	}
+	if len(handshakeConfig.NextProtos) == 0 {
+		handshakeConfig.NextProtos = []string{"http/1.1"}
+	}
+	if configuration.tlsResume {
+		handshakeConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	} else {
+		handshakeConfig.SessionTicketsDisabled = true
+	}
+	return &handshaker{handshakeConfig, newDialFunc(configuration, opened, nil), handshakeResult{}}
+}
+
+// RoundTrip sends a request over a connection of its own, timing its TLS handshake
+func (handshaker *handshaker) RoundTrip(ctx context.Context, request *OutgoingRequest) (*Response, error) {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	setFastHTTPRequest(req, request)
+
+	uri := req.URI()
+	if string(uri.Scheme()) != "https" {
+		return nil, errors.New("only https URLs can be sent in TLS handshake mode: " + uri.String())
+	}
+	host := string(uri.Host())
+	address := host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		address = net.JoinHostPort(host, "443")
+	} else {
+		host, _, _ = net.SplitHostPort(host)
+	}
+
+	rawConn, err := handshaker.dial(address)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := handshaker.tlsConfig
+	if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+	conn := tls.Client(rawConn, tlsConfig)
+	defer conn.Close()
+	// Closing the connection interrupts the handshake or the request when the context is done
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	handshakeStart := time.Now()
+	if err := conn.Handshake(); err != nil {
+		handshaker.result.failures++
+		return nil, err
+	}
+	handshaker.result.record(time.Since(handshakeStart), conn.ConnectionState())
+
+	req.SetConnectionClose()
+	writer := bufio.NewWriter(conn)
+	if err := req.Write(writer); err != nil {
+		return nil, err
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	// Reading the response also reads the session tickets, which TLS 1.3 servers send after the handshake
+	if err := resp.Read(bufio.NewReader(conn)); err != nil {
+		return nil, err
+	}
+	return newFastHTTPResponse(resp), nil
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"encoding/json"
+	"errors"
+	neturl "net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// harFile is the subset of the HTTP Archive format (http://www.softwareishard.com/blog/har-12-spec/) used by Baton
+type harFile struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time `json:"startedDateTime"`
+	Request         struct {
+		Method   string         `json:"method"`
+		URL      string         `json:"url"`
+		Headers  []harNameValue `json:"headers"`
+		Cookies  []harNameValue `json:"cookies"`
+		PostData *struct {
+			MimeType string         `json:"mimeType"`
+			Text     string         `json:"text"`
+			Params   []harNameValue `json:"params"`
+		} `json:"postData"`
+	} `json:"request"`
+	Response struct {
+		Content struct {
+			MimeType string `json:"mimeType"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func matchesDomain(host string, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	for _, domain := range domains {
+		if strings.EqualFold(host, domain) || strings.HasSuffix(strings.ToLower(host), "."+strings.ToLower(domain)) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesContentType(contentType string, contentTypes []string) bool {
+	if len(contentTypes) == 0 {
+		return true
+	}
+	for _, expected := range contentTypes {
+		if strings.HasPrefix(strings.ToLower(contentType), strings.ToLower(expected)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (entry harEntry) toPreLoadedRequest() preLoadedRequest {
+	var headers [][]string
+	hasCookieHeader := false
+	for _, header := range entry.Request.Headers {
+		// HTTP/2 pseudo headers and the content length are set by the client
+		if strings.HasPrefix(header.Name, ":") || strings.EqualFold(header.Name, "Content-Length") || strings.EqualFold(header.Name, "Host") {
+			continue
+		}
+		hasCookieHeader = hasCookieHeader || strings.EqualFold(header.Name, "Cookie")
+		headers = append(headers, []string{header.Name, header.Value})
+	}
+
+	if !hasCookieHeader && len(entry.Request.Cookies) > 0 {
+		cookies := make([]string, len(entry.Request.Cookies))
+		for i, cookie := range entry.Request.Cookies {
+			cookies[i] = cookie.Name + "=" + cookie.Value
+		}
+		headers = append(headers, []string{"Cookie", strings.Join(cookies, "; ")})
+	}
+
+	body := ""
+	if postData := entry.Request.PostData; postData != nil {
+		body = postData.Text
+		if body == "" && len(postData.Params) > 0 {
+			values := neturl.Values{}
+			for _, param := range postData.Params {
+				values.Add(param.Name, param.Value)
+			}
+			body = values.Encode()
+		}
+	}
+
+	return preLoadedRequest{method: entry.Request.Method, url: entry.Request.URL, body: body, headers: headers, weight: 1}
+}
+
+func preLoadRequestsFromHARFile(filename string, domains []string, contentTypes []string) ([]preLoadedRequest, error) {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var har harFile
+	if err := json.NewDecoder(file).Decode(&har); err != nil {
+		return nil, err
+	}
+
+	entries := har.Log.Entries
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].StartedDateTime.Before(entries[j].StartedDateTime)
+	})
+
+	var requests []preLoadedRequest
+	var firstStarted time.Time
+
+	for _, entry := range entries {
+		parsedURL, err := neturl.Parse(entry.Request.URL)
+		if err != nil {
+			return nil, err
+		}
+		if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+			continue
+		}
+		if !matchesDomain(parsedURL.Hostname(), domains) || !matchesContentType(entry.Response.Content.MimeType, contentTypes) {
+			continue
+		}
+
+		if len(requests) == 0 {
+			firstStarted = entry.StartedDateTime
+		}
+		request := entry.toPreLoadedRequest()
+		request.offset = entry.StartedDateTime.Sub(firstStarted)
+		requests = append(requests, request)
+	}
+
+	if len(entries) > 0 && len(requests) == 0 {
+		return nil, errors.New("no HAR entries matched the given filters")
+	}
+
+	return requests, nil
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+// Hook sees every request before it is sent and every response after it arrives, whichever transport sends them.
+// Hooks are shared by all the virtual users, so they have to be safe for concurrent use.
+type Hook interface {
+	// BeforeRequest may change the request, e.g. to sign it
+	BeforeRequest(request *OutgoingRequest)
+	// AfterResponse may check the response, an error counting it as a failed expectation
+	AfterResponse(request *OutgoingRequest, response *Response) error
+}
+
+// HookFuncs is a Hook made of functions, either of which can be nil
+type HookFuncs struct {
+	Before func(request *OutgoingRequest)
+	After  func(request *OutgoingRequest, response *Response) error
+}
+
+// BeforeRequest calls Before if it is set
+func (hook HookFuncs) BeforeRequest(request *OutgoingRequest) {
+	if hook.Before != nil {
+		hook.Before(request)
+	}
+}
+
+// AfterResponse calls After if it is set
+func (hook HookFuncs) AfterResponse(request *OutgoingRequest, response *Response) error {
+	if hook.After != nil {
+		return hook.After(request, response)
+	}
+	return nil
+}
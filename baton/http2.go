@@ -0,0 +1,105 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// http2Transport sends requests over a single HTTP/2 connection to each host, negotiated with ALPN for https URLs and
+// assumed with prior knowledge (h2c) for http ones. The requests of the virtual users sharing it are multiplexed as
+// concurrent streams over the connection.
+type http2Transport struct {
+	transport  Transport
+	slots      chan struct{} // Holds a value for every stream open when their number is limited, nil otherwise
+	streams    int32
+	maxStreams int32
+}
+
+func newHTTP2Transport(configuration Configuration, tlsConfig *tls.Config, opened *uint64) *http2Transport {
+	dial := newDialFunc(configuration, opened, nil)
+	protocols := new(http.Protocols)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	// http.Transport sets up the TLS configuration it is given, so each transport needs a copy of its own
+	if tlsConfig != nil {
+		tlsConfig = tlsConfig.Clone()
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dial(addr)
+		},
+		TLSClientConfig: tlsConfig,
+		IdleConnTimeout: configuration.idleTimeout,
+		Protocols:       protocols,
+		// The first requests wait for the connection instead of opening more, and later ones wait for a stream
+		// rather than opening another connection when the server limits them
+		MaxConnsPerHost: 1,
+		HTTP2:           &http.HTTP2Config{StrictMaxConcurrentRequests: true},
+	}
+	var slots chan struct{}
+	if configuration.http2Streams > 0 {
+		slots = make(chan struct{}, configuration.http2Streams)
+	}
+	return &http2Transport{NewHTTPTransport(&http.Client{Transport: transport}), slots, 0, 0}
+}
+
+// newHTTP2Transports returns the transports the virtual users are spread over, one for each connection
+func newHTTP2Transports(configuration Configuration, tlsConfig *tls.Config, opened *uint64) []*http2Transport {
+	transports := make([]*http2Transport, configuration.http2Conns)
+	for i := range transports {
+		transports[i] = newHTTP2Transport(configuration, tlsConfig, opened)
+	}
+	return transports
+}
+
+func (transport *http2Transport) RoundTrip(ctx context.Context, request *OutgoingRequest) (*Response, error) {
+	if transport.slots != nil {
+		select {
+		case transport.slots <- struct{}{}:
+			defer func() { <-transport.slots }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	streams := atomic.AddInt32(&transport.streams, 1)
+	defer atomic.AddInt32(&transport.streams, -1)
+	for {
+		maxStreams := atomic.LoadInt32(&transport.maxStreams)
+		if streams <= maxStreams || atomic.CompareAndSwapInt32(&transport.maxStreams, maxStreams, streams) {
+			break
+		}
+	}
+	return transport.transport.RoundTrip(ctx, request)
+}
+
+// maxConcurrentStreams returns the most streams open at once over any of the HTTP/2 connections of the transports
+func maxConcurrentStreams(transports []Transport) int {
+	most := 0
+	for _, transport := range transports {
+		if http2Transport, ok := transport.(*http2Transport); ok {
+			if streams := int(atomic.LoadInt32(&http2Transport.maxStreams)); streams > most {
+				most = streams
+			}
+		}
+	}
+	return most
+}
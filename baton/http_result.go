@@ -14,33 +14,49 @@
  * permissions and limitations under the License.
  */
 
-package main
+package baton
 
 import "math"
 
 // HTTPResult contains counters for the responses to the HTTP requests
 type HTTPResult struct {
 	connectionErrorCount int
+	timeoutCount         int
+	templateErrorCount   int
 	status1xxCount       int
 	status2xxCount       int
 	status3xxCount       int
 	status4xxCount       int
 	status5xxCount       int
+	expectationFailures  int
+	errorExpectations    int // Failed expectations on 4xx and 5xx responses, which are already errors
 	maxTime              int
 	minTime              int
 	timeSum              int64
 	totalSuccess         int
 	responseTimes        []int
+	censoredTimes        []int // Time waited by the requests which timed out, only a lower bound of their response time
 	responseTimesPercent [][3]int
+	requestCounts        []int
+	scenarioResult       scenarioResult
+	handshakeResult      handshakeResult
 }
 
 func newHTTPResult() *HTTPResult {
-	return &HTTPResult{0, 0, 0, 0, 0, 0, 0, math.MaxInt64, 0, 0, make([]int, 0), make([][3]int, 0)}
+	return &HTTPResult{
+		minTime:              math.MaxInt64,
+		responseTimes:        make([]int, 0),
+		censoredTimes:        make([]int, 0),
+		responseTimesPercent: make([][3]int, 0),
+		requestCounts:        make([]int, 0),
+	}
 }
 
 func (httpResult HTTPResult) total() int {
 	totalRequestsCounter := 0
 	totalRequestsCounter += httpResult.connectionErrorCount
+	totalRequestsCounter += httpResult.timeoutCount
+	totalRequestsCounter += httpResult.templateErrorCount
 	totalRequestsCounter += httpResult.status1xxCount
 	totalRequestsCounter += httpResult.status2xxCount
 	totalRequestsCounter += httpResult.status3xxCount
@@ -49,3 +65,16 @@ func (httpResult HTTPResult) total() int {
 
 	return totalRequestsCounter
 }
+
+// failed returns the number of requests which failed in any way, counting each of them once
+func (httpResult HTTPResult) failed() int {
+	failedRequestsCounter := 0
+	failedRequestsCounter += httpResult.connectionErrorCount
+	failedRequestsCounter += httpResult.timeoutCount
+	failedRequestsCounter += httpResult.templateErrorCount
+	failedRequestsCounter += httpResult.status4xxCount
+	failedRequestsCounter += httpResult.status5xxCount
+	failedRequestsCounter += httpResult.expectationFailures - httpResult.errorExpectations
+
+	return failedRequestsCounter
+}
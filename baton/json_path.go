@@ -0,0 +1,105 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// parseJSONPath splits a JSONPath such as $.orders[0]['order id'] into its keys and indices.
+// Only the child and index operators are supported.
+func parseJSONPath(path string) ([]interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, errors.New("JSONPath must start with $: " + path)
+	}
+
+	var parts []interface{}
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			if end == 0 {
+				return nil, errors.New("invalid JSONPath: " + path)
+			}
+			parts = append(parts, rest[1:end+1])
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, errors.New("invalid JSONPath: " + path)
+			}
+			selector := rest[1:end]
+			if len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0] {
+				parts = append(parts, selector[1:len(selector)-1])
+			} else if index, err := strconv.Atoi(selector); err == nil {
+				parts = append(parts, index)
+			} else {
+				return nil, errors.New("unsupported JSONPath selector: " + selector)
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, errors.New("invalid JSONPath: " + path)
+		}
+	}
+	return parts, nil
+}
+
+// evaluateJSONPath returns the value found at a parsed path in a JSON document, strings as they are and anything else as JSON
+func evaluateJSONPath(document []byte, path []interface{}) (string, bool) {
+	var value interface{}
+	if err := json.Unmarshal(document, &value); err != nil {
+		return "", false
+	}
+
+	for _, part := range path {
+		switch key := part.(type) {
+		case string:
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return "", false
+			}
+			if value, ok = object[key]; !ok {
+				return "", false
+			}
+		case int:
+			array, ok := value.([]interface{})
+			if !ok {
+				return "", false
+			}
+			if key < 0 {
+				key += len(array)
+			}
+			if key < 0 || key >= len(array) {
+				return "", false
+			}
+			value = array[key]
+		}
+	}
+
+	if text, ok := value.(string); ok {
+		return text, true
+	}
+	encoded, err := json.Marshal(value)
+	return string(encoded), err == nil
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// jsonRequest is a single line of a JSON Lines requests file
+type jsonRequest struct {
+	Name       string                     `json:"name"`
+	Method     string                     `json:"method"`
+	URL        string                     `json:"url"`
+	Headers    map[string]json.RawMessage `json:"headers"`
+	Body       string                     `json:"body"`
+	BodyBase64 string                     `json:"bodyBase64"`
+	Weight     int                        `json:"weight"`
+	Expect     *jsonExpectation           `json:"expect"`
+}
+
+type jsonExpectation struct {
+	Status       int                        `json:"status"`
+	BodyContains string                     `json:"bodyContains"`
+	Headers      map[string]json.RawMessage `json:"headers"`
+}
+
+// extractJSONHeaders flattens a map of header values, each being either a string or an array of strings
+func extractJSONHeaders(rawHeaders map[string]json.RawMessage) ([][]string, error) {
+	keys := make([]string, 0, len(rawHeaders))
+	for key := range rawHeaders {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var headers [][]string
+	for _, key := range keys {
+		var value string
+		if err := json.Unmarshal(rawHeaders[key], &value); err == nil {
+			headers = append(headers, []string{key, value})
+			continue
+		}
+		var values []string
+		if err := json.Unmarshal(rawHeaders[key], &values); err != nil {
+			return nil, errors.New("invalid value for header " + key)
+		}
+		for _, value := range values {
+			headers = append(headers, []string{key, value})
+		}
+	}
+	return headers, nil
+}
+
+func (request jsonRequest) toPreLoadedRequest() (preLoadedRequest, error) {
+	if request.Method == "" || request.URL == "" {
+		return preLoadedRequest{}, errors.New("method and url are required")
+	}
+
+	body := request.Body
+	if request.BodyBase64 != "" {
+		if request.Body != "" {
+			return preLoadedRequest{}, errors.New("only one of body and bodyBase64 may be set")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(request.BodyBase64)
+		if err != nil {
+			return preLoadedRequest{}, err
+		}
+		body = string(decoded)
+	}
+
+	weight := request.Weight
+	if weight == 0 {
+		weight = 1
+	}
+	if weight < 0 {
+		return preLoadedRequest{}, errors.New("invalid weight, must be a positive integer")
+	}
+
+	headers, err := extractJSONHeaders(request.Headers)
+	if err != nil {
+		return preLoadedRequest{}, err
+	}
+
+	var expectation *responseExpectation
+	if request.Expect != nil {
+		expectedHeaders, err := extractJSONHeaders(request.Expect.Headers)
+		if err != nil {
+			return preLoadedRequest{}, err
+		}
+		expectation = &responseExpectation{request.Expect.Status, request.Expect.BodyContains, expectedHeaders}
+	}
+
+	return preLoadedRequest{method: request.Method, url: request.URL, body: body, headers: headers, weight: weight, name: request.Name, expect: expectation}, nil
+}
+
+func preLoadRequestsFromJSONLFile(filename string) ([]preLoadedRequest, error) {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	var requests []preLoadedRequest
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var rawRequest jsonRequest
+		if err := json.Unmarshal([]byte(line), &rawRequest); err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		request, err := rawRequest.toPreLoadedRequest()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+		requests = append(requests, request)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
@@ -14,7 +14,7 @@
  * permissions and limitations under the License.
  */
 
-package main
+package baton
 
 import "fmt"
 
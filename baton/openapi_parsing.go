@@ -0,0 +1,435 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The maximum depth to which schemas are followed when generating example values
+const maxSchemaDepth = 8
+
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch"}
+
+// openAPIDocument wraps an OpenAPI 3 or Swagger 2 document, decoded into generic maps so $refs can be followed
+type openAPIDocument struct {
+	root    map[string]interface{}
+	swagger bool
+}
+
+// openAPIFilter selects the operations of a document which are loaded
+type openAPIFilter struct {
+	server      string
+	tags        []string
+	excludeTags []string
+}
+
+// normalizeYAML converts the maps produced by the YAML decoder into maps with string keys, as produced by encoding/json
+func normalizeYAML(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		normalized := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			normalized[fmt.Sprint(key)] = normalizeYAML(item)
+		}
+		return normalized
+	case map[string]interface{}:
+		for key, item := range typed {
+			typed[key] = normalizeYAML(item)
+		}
+		return typed
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = normalizeYAML(item)
+		}
+		return typed
+	default:
+		return value
+	}
+}
+
+func asMap(value interface{}) map[string]interface{} {
+	typed, _ := value.(map[string]interface{})
+	return typed
+}
+
+func asSlice(value interface{}) []interface{} {
+	typed, _ := value.([]interface{})
+	return typed
+}
+
+func asString(value interface{}) string {
+	typed, _ := value.(string)
+	return typed
+}
+
+// sortedKeys returns the keys of an object in order, so that the same examples are picked on every run
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// resolve follows a local $ref (such as #/components/schemas/Pet) if the given object is a reference
+func (document *openAPIDocument) resolve(value interface{}) map[string]interface{} {
+	object := asMap(value)
+	for depth := 0; depth < maxSchemaDepth; depth++ {
+		ref := asString(object["$ref"])
+		if !strings.HasPrefix(ref, "#/") {
+			return object
+		}
+		var target interface{} = document.root
+		for _, part := range strings.Split(ref[2:], "/") {
+			part = strings.Replace(strings.Replace(part, "~1", "/", -1), "~0", "~", -1)
+			target = asMap(target)[part]
+		}
+		object = asMap(target)
+	}
+	return object
+}
+
+// baseURL determines the URL the paths of the document are relative to. The server given on the command line replaces
+// the scheme and host of the one of the document, whose path (the base path of Swagger) is kept after its own.
+func (document *openAPIDocument) baseURL(server string) (string, error) {
+	if document.swagger {
+		if server != "" {
+			return joinServerPath(server, asString(document.root["basePath"]))
+		}
+		host := asString(document.root["host"])
+		if host == "" {
+			host = "localhost"
+		}
+		scheme := "http"
+		if schemes := asSlice(document.root["schemes"]); len(schemes) > 0 {
+			scheme = asString(schemes[0])
+		}
+		return scheme + "://" + host + asString(document.root["basePath"]), nil
+	}
+
+	servers := asSlice(document.root["servers"])
+	if len(servers) == 0 {
+		if server != "" {
+			return server, nil
+		}
+		return "http://localhost", nil
+	}
+	documentServer := asMap(servers[0])
+	url := asString(documentServer["url"])
+	for name, variable := range asMap(documentServer["variables"]) {
+		url = strings.Replace(url, "{"+name+"}", fmt.Sprint(asMap(variable)["default"]), -1)
+	}
+
+	parsedURL, err := neturl.Parse(url)
+	if err != nil {
+		return "", errors.New("invalid server URL: " + url)
+	}
+	if server != "" {
+		return joinServerPath(server, parsedURL.Path)
+	}
+	if !parsedURL.IsAbs() {
+		return "", errors.New("the server URL of the document is relative (" + url + "), set the URL it is relative to with -openapi-server")
+	}
+	return url, nil
+}
+
+// joinServerPath appends the path of the server of the document to the one of the server given on the command line
+func joinServerPath(server string, path string) (string, error) {
+	base, err := neturl.Parse(server)
+	if err != nil || !base.IsAbs() {
+		return "", errors.New("invalid OpenAPI server: " + server)
+	}
+	if path = strings.Trim(path, "/"); path != "" {
+		base.Path = strings.TrimSuffix(base.Path, "/") + "/" + path
+	}
+	return base.String(), nil
+}
+
+// exampleValue returns an example for a schema, using the documented example, default or enum values where possible
+func (document *openAPIDocument) exampleValue(schema map[string]interface{}, depth int) interface{} {
+	schema = document.resolve(schema)
+	if schema == nil || depth > maxSchemaDepth {
+		return nil
+	}
+	if example, ok := schema["example"]; ok {
+		return example
+	}
+	if value, ok := schema["default"]; ok {
+		return value
+	}
+	if enum := asSlice(schema["enum"]); len(enum) > 0 {
+		return enum[0]
+	}
+	for _, combined := range []string{"allOf", "oneOf", "anyOf"} {
+		if schemas := asSlice(schema[combined]); len(schemas) > 0 {
+			if combined != "allOf" {
+				return document.exampleValue(asMap(schemas[0]), depth+1)
+			}
+			merged := map[string]interface{}{}
+			for _, part := range schemas {
+				for key, value := range asMap(document.exampleValue(asMap(part), depth+1)) {
+					merged[key] = value
+				}
+			}
+			return merged
+		}
+	}
+
+	switch asString(schema["type"]) {
+	case "integer":
+		if minimum, ok := schema["minimum"]; ok {
+			return minimum
+		}
+		return 1
+	case "number":
+		if minimum, ok := schema["minimum"]; ok {
+			return minimum
+		}
+		return 1.5
+	case "boolean":
+		return true
+	case "array":
+		return []interface{}{document.exampleValue(asMap(schema["items"]), depth+1)}
+	case "string":
+		switch asString(schema["format"]) {
+		case "date-time":
+			return time.Now().UTC().Format(time.RFC3339)
+		case "date":
+			return time.Now().UTC().Format("2006-01-02")
+		case "uuid":
+			return "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+		case "email":
+			return "user@example.com"
+		case "uri":
+			return "http://example.com"
+		}
+		return "string"
+	default:
+		object := map[string]interface{}{}
+		for name, property := range asMap(schema["properties"]) {
+			object[name] = document.exampleValue(asMap(property), depth+1)
+		}
+		return object
+	}
+}
+
+// parameterValue returns an example value for a parameter, or false if an optional parameter should be left out
+func (document *openAPIDocument) parameterValue(parameter map[string]interface{}) (string, bool) {
+	if example, ok := parameter["example"]; ok {
+		return fmt.Sprint(example), true
+	}
+	examples := asMap(parameter["examples"])
+	for _, name := range sortedKeys(examples) {
+		return fmt.Sprint(document.resolve(examples[name])["value"]), true
+	}
+	required, _ := parameter["required"].(bool)
+	if !required {
+		return "", false
+	}
+	schema := asMap(parameter["schema"])
+	if document.swagger {
+		schema = parameter
+	}
+	return fmt.Sprint(document.exampleValue(schema, 0)), true
+}
+
+// requestBody returns an example body and its content type for an operation
+func (document *openAPIDocument) requestBody(operation map[string]interface{}, parameters []map[string]interface{}) (string, string, error) {
+	if document.swagger {
+		form := neturl.Values{}
+		for _, parameter := range parameters {
+			switch asString(parameter["in"]) {
+			case "body":
+				body, err := json.Marshal(document.exampleValue(asMap(parameter["schema"]), 0))
+				return string(body), "application/json", err
+			case "formData":
+				if value, ok := document.parameterValue(parameter); ok {
+					form.Add(asString(parameter["name"]), value)
+				}
+			}
+		}
+		if len(form) > 0 {
+			return form.Encode(), "application/x-www-form-urlencoded", nil
+		}
+		return "", "", nil
+	}
+
+	content := asMap(document.resolve(operation["requestBody"])["content"])
+	for _, contentType := range sortedKeys(content) {
+		mediaType := asMap(content[contentType])
+		value, ok := mediaType["example"]
+		examples := asMap(mediaType["examples"])
+		for _, name := range sortedKeys(examples) {
+			if !ok {
+				value, ok = document.resolve(examples[name])["value"]
+			}
+		}
+		if !ok {
+			value = document.exampleValue(asMap(mediaType["schema"]), 0)
+		}
+
+		if text, isString := value.(string); isString && !strings.Contains(contentType, "json") {
+			return text, contentType, nil
+		}
+		if contentType == "application/x-www-form-urlencoded" {
+			form := neturl.Values{}
+			for key, item := range asMap(value) {
+				form.Add(key, fmt.Sprint(item))
+			}
+			return form.Encode(), contentType, nil
+		}
+		body, err := json.Marshal(value)
+		return string(body), contentType, err
+	}
+	return "", "", nil
+}
+
+func hasAnyTag(operation map[string]interface{}, tags []string) bool {
+	for _, tag := range asSlice(operation["tags"]) {
+		for _, expected := range tags {
+			if asString(tag) == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (document *openAPIDocument) preLoadedRequests(filter openAPIFilter) ([]preLoadedRequest, error) {
+	baseURL, err := document.baseURL(filter.server)
+	if err != nil {
+		return nil, err
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	paths := asMap(document.root["paths"])
+	var requests []preLoadedRequest
+	for _, path := range sortedKeys(paths) {
+		pathItem := document.resolve(paths[path])
+
+		for _, method := range openAPIMethods {
+			operation := asMap(pathItem[method])
+			if operation == nil {
+				continue
+			}
+			if len(filter.tags) > 0 && !hasAnyTag(operation, filter.tags) {
+				continue
+			}
+			if hasAnyTag(operation, filter.excludeTags) {
+				continue
+			}
+
+			// Operation parameters override the parameters shared by all operations of a path
+			var parameters []map[string]interface{}
+			overridden := map[string]bool{}
+			for _, rawParameter := range asSlice(operation["parameters"]) {
+				parameter := document.resolve(rawParameter)
+				overridden[asString(parameter["in"])+":"+asString(parameter["name"])] = true
+				parameters = append(parameters, parameter)
+			}
+			for _, rawParameter := range asSlice(pathItem["parameters"]) {
+				parameter := document.resolve(rawParameter)
+				if !overridden[asString(parameter["in"])+":"+asString(parameter["name"])] {
+					parameters = append(parameters, parameter)
+				}
+			}
+
+			requestPath := path
+			query := neturl.Values{}
+			var headers [][]string
+			var cookies []string
+			for _, parameter := range parameters {
+				name := asString(parameter["name"])
+				in := asString(parameter["in"])
+				if in == "path" {
+					parameter["required"] = true
+				}
+				value, ok := document.parameterValue(parameter)
+				if !ok {
+					continue
+				}
+				switch in {
+				case "path":
+					requestPath = strings.Replace(requestPath, "{"+name+"}", neturl.PathEscape(value), -1)
+				case "query":
+					query.Add(name, value)
+				case "header":
+					headers = append(headers, []string{name, value})
+				case "cookie":
+					cookies = append(cookies, name+"="+value)
+				}
+			}
+			if len(cookies) > 0 {
+				headers = append(headers, []string{"Cookie", strings.Join(cookies, "; ")})
+			}
+
+			body, contentType, err := document.requestBody(operation, parameters)
+			if err != nil {
+				return nil, err
+			}
+			if contentType != "" {
+				headers = append(headers, []string{"Content-Type", contentType})
+			}
+
+			url := baseURL + requestPath
+			if len(query) > 0 {
+				url += "?" + query.Encode()
+			}
+
+			name := asString(operation["operationId"])
+			if name == "" {
+				name = strings.ToUpper(method) + " " + path
+			}
+
+			requests = append(requests, preLoadedRequest{method: strings.ToUpper(method), url: url, body: body, headers: headers, weight: 1, name: name})
+		}
+	}
+
+	return requests, nil
+}
+
+func preLoadRequestsFromOpenAPIFile(filename string, filter openAPIFilter) ([]preLoadedRequest, error) {
+	contents, err := ioutil.ReadFile(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// YAML is a superset of JSON so both kinds of documents can be decoded the same way
+	var raw interface{}
+	if err := yaml.Unmarshal(contents, &raw); err != nil {
+		return nil, err
+	}
+
+	root := asMap(normalizeYAML(raw))
+	document := &openAPIDocument{root, root["swagger"] != nil}
+	if !document.swagger && root["openapi"] == nil {
+		return nil, errors.New("not an OpenAPI or Swagger document")
+	}
+
+	return document.preLoadedRequests(filter)
+}
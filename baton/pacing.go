@@ -0,0 +1,134 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	fixedDistribution       = "fixed"
+	uniformDistribution     = "uniform"
+	normalDistribution      = "normal"
+	exponentialDistribution = "exponential"
+)
+
+// thinkTime is a random delay, following one of the supported distributions
+type thinkTime struct {
+	distribution string
+	first        time.Duration // The fixed value, the minimum or the mean
+	second       time.Duration // The maximum or the standard deviation
+}
+
+// pacing controls the delays a virtual user leaves between its requests
+type pacing struct {
+	thinkTime *thinkTime    // Time to wait after every request (nil for none)
+	interval  time.Duration // Target time between the start of two iterations (0 for none)
+}
+
+// parseThinkTime parses a think time such as 500ms, fixed:500ms, uniform:1s,3s, normal:2s,500ms or exponential:2s
+func parseThinkTime(spec string) (*thinkTime, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	distribution, arguments := fixedDistribution, spec
+	if parts := strings.SplitN(spec, ":", 2); len(parts) == 2 {
+		distribution, arguments = parts[0], parts[1]
+	}
+
+	var durations []time.Duration
+	for _, argument := range strings.Split(arguments, ",") {
+		duration, err := time.ParseDuration(strings.TrimSpace(argument))
+		if err != nil {
+			return nil, err
+		}
+		if duration < 0 {
+			return nil, errors.New("think time cannot be negative: " + argument)
+		}
+		durations = append(durations, duration)
+	}
+
+	expectedArguments := map[string]int{fixedDistribution: 1, exponentialDistribution: 1, uniformDistribution: 2, normalDistribution: 2}
+	count, ok := expectedArguments[distribution]
+	if !ok {
+		return nil, errors.New("unknown think time distribution: " + distribution)
+	}
+	if len(durations) != count {
+		return nil, errors.New("wrong number of values for a " + distribution + " think time: " + arguments)
+	}
+
+	thinkTime := &thinkTime{distribution: distribution, first: durations[0]}
+	if count == 2 {
+		thinkTime.second = durations[1]
+	}
+	if distribution == uniformDistribution && thinkTime.second < thinkTime.first {
+		return nil, errors.New("the maximum of a uniform think time must not be less than its minimum")
+	}
+	return thinkTime, nil
+}
+
+func (thinkTime *thinkTime) next() time.Duration {
+	var value float64
+	switch thinkTime.distribution {
+	case uniformDistribution:
+		value = float64(thinkTime.first) + rand.Float64()*float64(thinkTime.second-thinkTime.first)
+	case normalDistribution:
+		value = float64(thinkTime.first) + rand.NormFloat64()*float64(thinkTime.second)
+	case exponentialDistribution:
+		value = rand.ExpFloat64() * float64(thinkTime.first)
+	default:
+		value = float64(thinkTime.first)
+	}
+	if value < 0 {
+		return 0
+	}
+	return time.Duration(value)
+}
+
+// sleep waits for the given time, without going past the end of the worker's run
+func (worker *worker) sleep(duration time.Duration) {
+	if !worker.deadline.IsZero() {
+		if remaining := time.Until(worker.deadline); remaining < duration {
+			duration = remaining
+		}
+	}
+	if duration > 0 {
+		select {
+		case <-time.After(duration):
+		case <-worker.ctx.Done():
+		}
+	}
+}
+
+// think waits for the think time of the worker's virtual user after a request
+func (worker *worker) think() {
+	if worker.pacing.thinkTime != nil {
+		worker.sleep(worker.pacing.thinkTime.next())
+	}
+}
+
+// pace thinks after the last request of an iteration, then waits until the next iteration is due
+func (worker *worker) pace(iterationStart time.Time) {
+	worker.think()
+	if worker.pacing.interval > 0 {
+		worker.sleep(time.Until(iterationStart.Add(worker.pacing.interval)))
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"crypto/tls"
+	"github.com/valyala/fasthttp"
+	"net"
+	"sync"
+	"time"
+)
+
+// pipelineClient pipelines the requests of all the workers over a few connections to each host they are sent to
+type pipelineClient struct {
+	configuration Configuration
+	tlsConfig     *tls.Config
+	opened        *uint64
+	hosts         map[string]*fasthttp.PipelineClient
+	mutex         sync.Mutex
+}
+
+func newPipelineClient(configuration Configuration, tlsConfig *tls.Config, opened *uint64) *pipelineClient {
+	return &pipelineClient{configuration, tlsConfig, opened, make(map[string]*fasthttp.PipelineClient), sync.Mutex{}}
+}
+
+// hostClient returns the client pipelining the requests sent to the host of a request
+func (client *pipelineClient) hostClient(req *fasthttp.Request) *fasthttp.PipelineClient {
+	uri := req.URI()
+	isTLS := string(uri.Scheme()) == "https"
+	key := string(uri.Scheme()) + "://" + string(uri.Host())
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	hostClient, found := client.hosts[key]
+	if !found {
+		hostClient = &fasthttp.PipelineClient{
+			Addr:                addMissingPort(string(uri.Host()), isTLS),
+			MaxConns:            client.configuration.pipelineConns,
+			MaxPendingRequests:  client.configuration.pipeline,
+			Dial:                newDialFunc(client.configuration, client.opened, nil),
+			IsTLS:               isTLS,
+			TLSConfig:           client.tlsConfig,
+			MaxIdleConnDuration: client.configuration.idleTimeout,
+		}
+		client.hosts[key] = hostClient
+	}
+	return hostClient
+}
+
+// addMissingPort adds the default port of the scheme to a host without one, which fasthttp leaves to its dial function
+// when it is given one
+func addMissingPort(host string, isTLS bool) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	if isTLS {
+		return host + ":443"
+	}
+	return host + ":80"
+}
+
+func (client *pipelineClient) Do(req *fasthttp.Request, resp *fasthttp.Response) error {
+	return client.hostClient(req).Do(req, resp)
+}
+
+func (client *pipelineClient) DoTimeout(req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error {
+	return client.hostClient(req).DoTimeout(req, resp, timeout)
+}
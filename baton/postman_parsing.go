@@ -0,0 +1,361 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	neturl "net/url"
+	"regexp"
+	"strings"
+)
+
+var postmanVariablePattern = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+
+// postmanCollection is the subset of the Postman collection v2.1 format (https://schema.getpostman.com/) used by Baton
+type postmanCollection struct {
+	Info struct {
+		Schema string `json:"schema"`
+	} `json:"info"`
+	Item     []postmanItem     `json:"item"`
+	Auth     *postmanAuth      `json:"auth"`
+	Variable []postmanKeyValue `json:"variable"`
+}
+
+// postmanItem is either a folder, holding more items, or a single request
+type postmanItem struct {
+	Name    string          `json:"name"`
+	Item    []postmanItem   `json:"item"`
+	Auth    *postmanAuth    `json:"auth"`
+	Request json.RawMessage `json:"request"`
+}
+
+type postmanRequest struct {
+	Method string            `json:"method"`
+	Header []postmanKeyValue `json:"header"`
+	URL    json.RawMessage   `json:"url"`
+	Auth   *postmanAuth      `json:"auth"`
+	Body   *postmanBody      `json:"body"`
+}
+
+type postmanBody struct {
+	Mode       string            `json:"mode"`
+	Raw        string            `json:"raw"`
+	URLEncoded []postmanKeyValue `json:"urlencoded"`
+	FormData   []postmanKeyValue `json:"formdata"`
+	GraphQL    *struct {
+		Query     string `json:"query"`
+		Variables string `json:"variables"`
+	} `json:"graphql"`
+	Options struct {
+		Raw struct {
+			Language string `json:"language"`
+		} `json:"raw"`
+	} `json:"options"`
+}
+
+type postmanAuth struct {
+	Type   string            `json:"type"`
+	Basic  []postmanKeyValue `json:"basic"`
+	Bearer []postmanKeyValue `json:"bearer"`
+	APIKey []postmanKeyValue `json:"apikey"`
+}
+
+type postmanKeyValue struct {
+	Key      string      `json:"key"`
+	Value    interface{} `json:"value"`
+	Type     string      `json:"type"`
+	Disabled bool        `json:"disabled"`
+	Enabled  *bool       `json:"enabled"`
+}
+
+// postmanEnvironmentFile is an environment exported from Postman
+type postmanEnvironmentFile struct {
+	Values []postmanKeyValue `json:"values"`
+}
+
+func (keyValue postmanKeyValue) enabled() bool {
+	return !keyValue.Disabled && (keyValue.Enabled == nil || *keyValue.Enabled)
+}
+
+func (keyValue postmanKeyValue) value() string {
+	switch value := keyValue.Value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	}
+}
+
+// postmanLoader turns the items of a collection into pre-loaded requests
+type postmanLoader struct {
+	variables map[string]string
+	requests  []preLoadedRequest
+	logger    *log.Logger
+}
+
+// resolve replaces the {{variables}} known to the collection or environment, leaving any others untouched
+func (loader *postmanLoader) resolve(text string) string {
+	for i := 0; i < 10 && postmanVariablePattern.MatchString(text); i++ {
+		resolved := postmanVariablePattern.ReplaceAllStringFunc(text, func(match string) string {
+			name := postmanVariablePattern.FindStringSubmatch(match)[1]
+			if value, ok := loader.variables[name]; ok {
+				return value
+			}
+			return match
+		})
+		if resolved == text {
+			break
+		}
+		text = resolved
+	}
+	return text
+}
+
+func authValue(values []postmanKeyValue, key string) string {
+	for _, value := range values {
+		if value.Key == key {
+			return value.value()
+		}
+	}
+	return ""
+}
+
+// applyAuth adds the credentials of an auth block to a request
+func (loader *postmanLoader) applyAuth(auth *postmanAuth, request *preLoadedRequest) error {
+	if auth == nil {
+		return nil
+	}
+
+	switch auth.Type {
+	case "noauth", "":
+	case "basic":
+		credentials := loader.resolve(authValue(auth.Basic, "username")) + ":" + loader.resolve(authValue(auth.Basic, "password"))
+		request.headers = append(request.headers, []string{"Authorization", "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))})
+	case "bearer":
+		request.headers = append(request.headers, []string{"Authorization", "Bearer " + loader.resolve(authValue(auth.Bearer, "token"))})
+	case "apikey":
+		key, value := loader.resolve(authValue(auth.APIKey, "key")), loader.resolve(authValue(auth.APIKey, "value"))
+		if authValue(auth.APIKey, "in") == "query" {
+			separator := "?"
+			if strings.Contains(request.url, "?") {
+				separator = "&"
+			}
+			request.url += separator + neturl.QueryEscape(key) + "=" + neturl.QueryEscape(value)
+		} else {
+			request.headers = append(request.headers, []string{key, value})
+		}
+	default:
+		return errors.New("unsupported auth type: " + auth.Type)
+	}
+	return nil
+}
+
+// buildBody returns the body of a request and the content type it implies
+func (loader *postmanLoader) buildBody(body *postmanBody) (string, string, error) {
+	if body == nil {
+		return "", "", nil
+	}
+
+	switch body.Mode {
+	case "raw":
+		contentType := ""
+		switch body.Options.Raw.Language {
+		case "json":
+			contentType = "application/json"
+		case "xml":
+			contentType = "application/xml"
+		}
+		return loader.resolve(body.Raw), contentType, nil
+	case "urlencoded":
+		values := neturl.Values{}
+		for _, field := range body.URLEncoded {
+			if field.enabled() {
+				values.Add(loader.resolve(field.Key), loader.resolve(field.value()))
+			}
+		}
+		return values.Encode(), "application/x-www-form-urlencoded", nil
+	case "formdata":
+		var buffer bytes.Buffer
+		writer := multipart.NewWriter(&buffer)
+		for _, field := range body.FormData {
+			if !field.enabled() {
+				continue
+			}
+			if field.Type == "file" {
+				return "", "", errors.New("file fields in form data are not supported")
+			}
+			if err := writer.WriteField(loader.resolve(field.Key), loader.resolve(field.value())); err != nil {
+				return "", "", err
+			}
+		}
+		if err := writer.Close(); err != nil {
+			return "", "", err
+		}
+		return buffer.String(), writer.FormDataContentType(), nil
+	case "graphql":
+		if body.GraphQL == nil {
+			return "", "", nil
+		}
+		graphQL := map[string]interface{}{"query": loader.resolve(body.GraphQL.Query)}
+		if variables := loader.resolve(body.GraphQL.Variables); variables != "" {
+			graphQL["variables"] = json.RawMessage(variables)
+		}
+		encoded, err := json.Marshal(graphQL)
+		return string(encoded), "application/json", err
+	default:
+		return "", "", nil
+	}
+}
+
+func (loader *postmanLoader) addRequest(name string, group string, rawRequest json.RawMessage, inheritedAuth *postmanAuth) error {
+	path := name
+	if group != "" {
+		path = group + "/" + name
+	}
+
+	var request postmanRequest
+	var rawURL string
+	if err := json.Unmarshal(rawRequest, &rawURL); err == nil {
+		request.URL, _ = json.Marshal(rawURL)
+	} else if err := json.Unmarshal(rawRequest, &request); err != nil {
+		return err
+	}
+
+	// The URL is either a string or an object holding the raw URL
+	if err := json.Unmarshal(request.URL, &rawURL); err != nil {
+		var url struct {
+			Raw string `json:"raw"`
+		}
+		if err := json.Unmarshal(request.URL, &url); err != nil {
+			return err
+		}
+		rawURL = url.Raw
+	}
+
+	method := strings.ToUpper(request.Method)
+	if method == "" {
+		method = "GET"
+	}
+
+	preLoaded := preLoadedRequest{method: method, url: loader.resolve(rawURL), weight: 1, name: name, group: group}
+	for _, header := range request.Header {
+		if header.enabled() {
+			preLoaded.headers = append(preLoaded.headers, []string{loader.resolve(header.Key), loader.resolve(header.value())})
+		}
+	}
+
+	body, contentType, err := loader.buildBody(request.Body)
+	if err != nil {
+		return errors.New(path + ": " + err.Error())
+	}
+	preLoaded.body = body
+	if contentType != "" && !hasHeader(preLoaded.headers, "Content-Type") {
+		preLoaded.headers = append(preLoaded.headers, []string{"Content-Type", contentType})
+	}
+
+	auth := inheritedAuth
+	if request.Auth != nil && request.Auth.Type != "inherit" {
+		auth = request.Auth
+	}
+	if err := loader.applyAuth(auth, &preLoaded); err != nil {
+		// Sending the request without its credentials would only measure authentication failures
+		loader.logger.Printf("Skipping Postman request %s: %v\n", path, err)
+		return nil
+	}
+
+	loader.requests = append(loader.requests, preLoaded)
+	return nil
+}
+
+// addItems walks a folder, grouping its requests under the path of the folders they are in
+func (loader *postmanLoader) addItems(items []postmanItem, group string, inheritedAuth *postmanAuth) error {
+	for _, item := range items {
+		auth := inheritedAuth
+		if item.Auth != nil && item.Auth.Type != "inherit" {
+			auth = item.Auth
+		}
+
+		if item.Request != nil {
+			if err := loader.addRequest(item.Name, group, item.Request, auth); err != nil {
+				return err
+			}
+			continue
+		}
+		folder := item.Name
+		if group != "" {
+			folder = group + "/" + item.Name
+		}
+		if err := loader.addItems(item.Item, folder, auth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func preLoadRequestsFromPostmanFile(filename string, environmentFilename string, logger *log.Logger) ([]preLoadedRequest, error) {
+	contents, err := ioutil.ReadFile(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var collection postmanCollection
+	if err := json.Unmarshal(contents, &collection); err != nil {
+		return nil, err
+	}
+	if collection.Info.Schema != "" && !strings.Contains(collection.Info.Schema, "v2.") {
+		return nil, errors.New("unsupported Postman collection schema: " + collection.Info.Schema)
+	}
+
+	loader := &postmanLoader{variables: map[string]string{}, logger: logger}
+	for _, variable := range collection.Variable {
+		if variable.enabled() {
+			loader.variables[variable.Key] = variable.value()
+		}
+	}
+
+	// Environment variables take precedence over collection variables
+	if environmentFilename != "" {
+		contents, err := ioutil.ReadFile(environmentFilename)
+		if err != nil {
+			return nil, err
+		}
+		var environment postmanEnvironmentFile
+		if err := json.Unmarshal(contents, &environment); err != nil {
+			return nil, err
+		}
+		for _, variable := range environment.Values {
+			if variable.enabled() {
+				loader.variables[variable.Key] = variable.value()
+			}
+		}
+	}
+
+	if err := loader.addItems(collection.Item, "", collection.Auth); err != nil {
+		return nil, err
+	}
+	return loader.requests, nil
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"io"
+	"time"
+)
+
+// Report sums up the results of a run
+type Report struct {
+	TotalRequests       int
+	TimeTaken           time.Duration
+	RequestsPerSecond   int
+	ConnectionsOpened   int  // Only counted when connections are opened by Baton, not by a Config.Transport
+	CountsConnections   bool // Whether ConnectionsOpened was counted
+	MaxStreams          int  // Most concurrent streams over an HTTP/2 connection
+	HasResponseTimes    bool // Response times are only measured when sending a number of requests
+	MinResponseTime     time.Duration
+	MaxResponseTime     time.Duration // A lower bound when requests timed out
+	AverageResponseTime time.Duration // A lower bound when requests timed out
+	MeasuredResponses   int           // Responses whose time was measured
+	CensoredResponses   int           // Requests which timed out, whose time waited is only a lower bound of their response time
+	ConnectionErrors    int
+	Timeouts            int
+	TemplateErrors      int // Requests which were not sent as their template failed to render
+	Status1xx           int
+	Status2xx           int
+	Status3xx           int
+	Status4xx           int
+	Status5xx           int
+	ExpectationFailures int
+	FailedRequests      int            // Requests which failed in any way, each counted once
+	Metrics             []Metric       // Recorded by the script, by name
+	FullHandshakes      HandshakeStats // TLS handshakes which set up a new session, in TLS handshake mode
+	ResumedHandshakes   HandshakeStats // TLS handshakes which resumed a session, in TLS handshake mode
+	FailedHandshakes    int
+	Negotiated          map[string]int // Number of TLS handshakes by negotiated version, cipher suite and protocol
+
+	result Result
+}
+
+// ResultSink receives the report at the end of a run
+type ResultSink interface {
+	Write(report Report) error
+}
+
+type textSink struct {
+	out io.Writer
+}
+
+// NewTextSink returns a sink which prints reports the way the command line does
+func NewTextSink(out io.Writer) ResultSink {
+	return &textSink{out}
+}
+
+func (sink *textSink) Write(report Report) error {
+	report.Print(sink.out)
+	return nil
+}
+
+func newReport(result Result) Report {
+	return Report{
+		TotalRequests:       result.totalRequests,
+		TimeTaken:           result.timeTaken,
+		RequestsPerSecond:   result.requestsPerSecond,
+		ConnectionsOpened:   result.connectionsOpened,
+		CountsConnections:   result.countsConnections,
+		MaxStreams:          result.maxStreams,
+		HasResponseTimes:    result.hasResponseTimes(),
+		MinResponseTime:     time.Duration(result.minTime) * time.Millisecond,
+		MaxResponseTime:     time.Duration(result.maxTime) * time.Millisecond,
+		AverageResponseTime: time.Duration(float64(result.averageTime) * float64(time.Millisecond)),
+		MeasuredResponses:   len(result.httpResult.responseTimes),
+		CensoredResponses:   len(result.httpResult.censoredTimes),
+		ConnectionErrors:    result.httpResult.connectionErrorCount,
+		Timeouts:            result.httpResult.timeoutCount,
+		TemplateErrors:      result.httpResult.templateErrorCount,
+		Status1xx:           result.httpResult.status1xxCount,
+		Status2xx:           result.httpResult.status2xxCount,
+		Status3xx:           result.httpResult.status3xxCount,
+		Status4xx:           result.httpResult.status4xxCount,
+		Status5xx:           result.httpResult.status5xxCount,
+		ExpectationFailures: result.httpResult.expectationFailures,
+		FailedRequests:      result.httpResult.failed(),
+		Metrics:             result.metrics,
+		FullHandshakes:      newHandshakeStats(result.httpResult.handshakeResult.full),
+		ResumedHandshakes:   newHandshakeStats(result.httpResult.handshakeResult.resumed),
+		FailedHandshakes:    result.httpResult.handshakeResult.failures,
+		Negotiated:          result.httpResult.handshakeResult.negotiated,
+		result:              result,
+	}
+}
+
+// Print prints the report the way the command line does
+func (report Report) Print(out io.Writer) {
+	report.result.printResults(out)
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	csvFormat       = "csv"
+	jsonlFormat     = "jsonl"
+	harFormat       = "har"
+	curlFormat      = "curl"
+	openAPIFormat   = "openapi"
+	postmanFormat   = "postman"
+	accessLogFormat = "accesslog"
+)
+
+// detectRequestsFileFormat detects the format of a requests file from its extension, and from the root keys of the
+// document for JSON and YAML files. It returns an empty format when a JSON or YAML file is of no known kind.
+func detectRequestsFileFormat(filename string) string {
+	if strings.HasSuffix(strings.ToLower(filename), ".postman_collection.json") {
+		return postmanFormat
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jsonl", ".ndjson":
+		return jsonlFormat
+	case ".har":
+		return harFormat
+	case ".curl":
+		return curlFormat
+	case ".log":
+		return accessLogFormat
+	case ".yaml", ".yml", ".json":
+		return detectDocumentFormat(filename)
+	default:
+		return csvFormat
+	}
+}
+
+// detectDocumentFormat tells OpenAPI and Swagger documents, which have an openapi or swagger root key, from Postman
+// collections, which have info and item ones
+func detectDocumentFormat(filename string) string {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		// The error is reported when the file is parsed
+		return openAPIFormat
+	}
+	var root map[string]interface{}
+	if err := yaml.Unmarshal(contents, &root); err != nil {
+		return ""
+	}
+	if root["openapi"] != nil || root["swagger"] != nil {
+		return openAPIFormat
+	}
+	if root["info"] != nil && root["item"] != nil {
+		return postmanFormat
+	}
+	return ""
+}
+
+// parseHeaders parses headers given as "Name: value"
+func parseHeaders(rawHeaders []string) ([][]string, error) {
+	var headers [][]string
+	for _, rawHeader := range rawHeaders {
+		header := extractHeaders(rawHeader)
+		if header == nil || strings.TrimSpace(header[0]) == "" {
+			return nil, errors.New("invalid header, expected \"Name: value\": " + rawHeader)
+		}
+		headers = append(headers, []string{strings.TrimSpace(header[0]), strings.TrimSpace(header[1])})
+	}
+	return headers, nil
+}
+
+// addHeaders adds the headers a request does not set itself
+func addHeaders(requestHeaders [][]string, headers [][]string) [][]string {
+	for _, header := range headers {
+		if !hasHeader(requestHeaders, header[0]) {
+			requestHeaders = append(requestHeaders, header)
+		}
+	}
+	return requestHeaders
+}
+
+// splitList splits a comma separated option into its trimmed, non-empty values
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func preLoadRequestsFromFile(configuration Configuration, logger *log.Logger) ([]preLoadedRequest, error) {
+	filename := configuration.requestsFromFile
+	format := configuration.requestsFormat
+	if format == "" {
+		if format = detectRequestsFileFormat(filename); format == "" {
+			return nil, errors.New("the format of the requests file cannot be detected, set it with -format")
+		}
+	}
+
+	switch format {
+	case csvFormat:
+		return preLoadRequestsFromCSVFile(filename)
+	case jsonlFormat:
+		return preLoadRequestsFromJSONLFile(filename)
+	case harFormat:
+		return preLoadRequestsFromHARFile(filename, splitList(configuration.harDomains), splitList(configuration.harContentTypes))
+	case curlFormat:
+		return preLoadRequestsFromCurlFile(filename)
+	case openAPIFormat:
+		filter := openAPIFilter{configuration.openAPIServer, splitList(configuration.openAPITags), splitList(configuration.openAPIExcludeTags)}
+		return preLoadRequestsFromOpenAPIFile(filename, filter)
+	case postmanFormat:
+		return preLoadRequestsFromPostmanFile(filename, configuration.postmanEnvironment, logger)
+	case accessLogFormat:
+		return preLoadRequestsFromAccessLogFile(filename, configuration.logTarget, configuration.logPattern)
+	default:
+		return nil, errors.New("unsupported requests file format: " + format)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	randomOrder     = "random"
+	sequentialOrder = "sequential"
+	loopOrder       = "loop"
+	partitionOrder  = "partition"
+)
+
+// requestSelector decides which of the pre-loaded requests a worker sends next
+type requestSelector interface {
+	// next returns the index of the next request, or false once there are none left
+	next() (int, bool)
+}
+
+// randomSelector picks requests at random, in proportion to their weight
+type randomSelector struct {
+	weights []int
+}
+
+// sequentialSelector plays the requests in file order, shared between all workers
+type sequentialSelector struct {
+	cursor *uint64
+	total  int
+	loop   bool
+}
+
+// partitionSelector plays the requests in file order, only using the rows assigned to a single worker
+type partitionSelector struct {
+	position int
+	step     int
+	total    int
+}
+
+// timedReplaySelector holds back each request until its recorded offset from the start of the replay has passed
+type timedReplaySelector struct {
+	requestSelector
+	requests []preLoadedRequest
+	clock    *replayClock
+}
+
+type replayClock struct {
+	once      sync.Once
+	start     time.Time
+	speed     float64
+	cancelled <-chan struct{}
+}
+
+// hasRecordedTiming tells whether requests were loaded with the time they were recorded at, as from access logs and HAR
+// files
+func hasRecordedTiming(requests []preLoadedRequest) bool {
+	for _, request := range requests {
+		if request.offset != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newRequestSelectors returns the selector of each worker. When the recorded timing is kept, the selectors stop waiting
+// for the next request once cancelled is closed, and have none left.
+func newRequestSelectors(order string, requests []preLoadedRequest, workers int, keepTiming bool, speed float64, cancelled <-chan struct{}) []requestSelector {
+	selectors := make([]requestSelector, workers)
+	cursor := new(uint64)
+	weights := cumulativeWeights(requests)
+	clock := &replayClock{speed: speed, cancelled: cancelled}
+
+	for w := 0; w < workers; w++ {
+		switch order {
+		case sequentialOrder:
+			selectors[w] = &sequentialSelector{cursor, len(requests), false}
+		case loopOrder:
+			selectors[w] = &sequentialSelector{cursor, len(requests), true}
+		case partitionOrder:
+			selectors[w] = &partitionSelector{w, workers, len(requests)}
+		default:
+			selectors[w] = &randomSelector{weights}
+		}
+		if keepTiming {
+			selectors[w] = &timedReplaySelector{selectors[w], requests, clock}
+		}
+	}
+	return selectors
+}
+
+func cumulativeWeights(requests []preLoadedRequest) []int {
+	weights := make([]int, len(requests))
+	totalWeight := 0
+	for i := 0; i < len(requests); i++ {
+		totalWeight += requests[i].weight
+		weights[i] = totalWeight
+	}
+	return weights
+}
+
+func (selector *randomSelector) next() (int, bool) {
+	totalWeight := selector.weights[len(selector.weights)-1]
+	return sort.SearchInts(selector.weights, rand.Intn(totalWeight)+1), true
+}
+
+func (selector *sequentialSelector) next() (int, bool) {
+	index := int(atomic.AddUint64(selector.cursor, 1) - 1)
+	if index >= selector.total && !selector.loop {
+		return 0, false
+	}
+	return index % selector.total, true
+}
+
+func (selector *partitionSelector) next() (int, bool) {
+	if selector.position >= selector.total {
+		return 0, false
+	}
+	index := selector.position
+	selector.position += selector.step
+	return index, true
+}
+
+// waitUntil waits for the offset of a request to pass, returning false if the replay was cancelled in the meantime
+func (clock *replayClock) waitUntil(offset time.Duration) bool {
+	clock.once.Do(func() {
+		clock.start = time.Now()
+	})
+	timer := time.NewTimer(time.Until(clock.start.Add(time.Duration(float64(offset) / clock.speed))))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-clock.cancelled:
+		return false
+	}
+}
+
+func (selector *timedReplaySelector) next() (int, bool) {
+	index, ok := selector.requestSelector.next()
+	if ok && !selector.clock.waitUntil(selector.requests[index].offset) {
+		return 0, false
+	}
+	return index, ok
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Request is a request provided by a RequestSource
+type Request struct {
+	Method  string // GET by default
+	URL     string // May contain template expressions, like the body and header values
+	Body    string
+	Headers http.Header
+	Weight  int    // The relative frequency with which the request is picked (1 by default)
+	Name    string // An optional name used to identify the request in the results
+}
+
+// RequestSource provides the requests of a run
+type RequestSource interface {
+	Requests() ([]Request, error)
+}
+
+// RequestList is a RequestSource providing a fixed list of requests
+type RequestList []Request
+
+// Requests returns the requests of the list
+func (list RequestList) Requests() ([]Request, error) {
+	return list, nil
+}
+
+func (request Request) toPreLoadedRequest() (preLoadedRequest, error) {
+	if request.URL == "" {
+		return preLoadedRequest{}, errors.New("missing URL")
+	}
+	if request.Weight < 0 {
+		return preLoadedRequest{}, errors.New("negative weight")
+	}
+
+	method, weight := request.Method, request.Weight
+	if method == "" {
+		method = http.MethodGet
+	}
+	if weight == 0 {
+		weight = 1
+	}
+
+	names := make([]string, 0, len(request.Headers))
+	for name := range request.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var headers [][]string
+	for _, name := range names {
+		for _, value := range request.Headers[name] {
+			headers = append(headers, []string{name, value})
+		}
+	}
+
+	return preLoadedRequest{method: method, url: request.URL, body: request.Body, headers: headers, weight: weight, name: request.Name}, nil
+}
+
+func preLoadRequestsFromSource(source RequestSource) ([]preLoadedRequest, error) {
+	requests, err := source.Requests()
+	if err != nil {
+		return nil, err
+	}
+
+	preLoadedRequests := make([]preLoadedRequest, len(requests))
+	for i, request := range requests {
+		if preLoadedRequests[i], err = request.toPreLoadedRequest(); err != nil {
+			return nil, fmt.Errorf("request %d: %v", i+1, err)
+		}
+	}
+	return preLoadedRequests, nil
+}
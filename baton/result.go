@@ -0,0 +1,255 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Result contains the final output of a Baton execution
+type Result struct {
+	httpResult        HTTPResult
+	totalRequests     int
+	timeTaken         time.Duration
+	requestsPerSecond int
+	connectionsOpened int
+	countsConnections bool
+	maxStreams        int
+	hasStats          bool
+	averageTime       float32
+	minTime           int
+	maxTime           int
+	requestMix        []requestMixEntry
+	hasExpectations   bool
+	scenario          *scenario
+	metrics           []Metric
+}
+
+// requestMixEntry records how often a request loaded from file was sent
+type requestMixEntry struct {
+	label           string
+	group           string
+	count           int
+	expectedPercent float64
+	actualPercent   float64
+}
+
+func newResult() *Result {
+	return &Result{httpResult: *newHTTPResult()}
+}
+
+func (result *Result) printResults(out io.Writer) {
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "=========================== Results ========================================\n")
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Total requests:                            %10d\n", result.totalRequests)
+	fmt.Fprintf(out, "Time taken to complete requests:      %15s\n", result.timeTaken.String())
+	fmt.Fprintf(out, "Requests per second:                       %10d\n", result.requestsPerSecond)
+	// The connections of a custom transport are its own, so they are not counted
+	if result.countsConnections {
+		fmt.Fprintf(out, "Connections opened:                        %10d\n", result.connectionsOpened)
+	}
+	if result.maxStreams > 0 {
+		fmt.Fprintf(out, "Max concurrent streams per connection:     %10d\n", result.maxStreams)
+	}
+	// There are no response times to report when every request failed. The requests which timed out only give a lower
+	// bound of their response time, and so of the max and average, as well as of the min when no response was received.
+	censored := result.httpResult.censoredTimes
+	if result.hasResponseTimes() {
+		measured := len(result.httpResult.responseTimes) > 0
+		fmt.Fprintf(out, "Max response time (ms):                    %10s\n", lowerBound(strconv.Itoa(result.maxTime), len(censored) > 0))
+		fmt.Fprintf(out, "Min response time (ms):                    %10s\n", lowerBound(strconv.Itoa(result.minTime), !measured))
+		fmt.Fprintf(out, "Avg response time (ms):                    %10s\n", lowerBound(fmt.Sprintf("%.2f", result.averageTime), len(censored) > 0))
+	}
+	if result.hasStats && len(censored) > 0 {
+		fmt.Fprintf(out, "Responses censored at timeout:             %10d\n", len(censored))
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "========= Percentage of responses by status code ==========================\n")
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "Number of connection errors:               %10d\n", result.httpResult.connectionErrorCount)
+	fmt.Fprintf(out, "Number of timeouts:                        %10d\n", result.httpResult.timeoutCount)
+	if result.httpResult.templateErrorCount > 0 {
+		fmt.Fprintf(out, "Number of template errors:                 %10d\n", result.httpResult.templateErrorCount)
+	}
+	fmt.Fprintf(out, "Number of 1xx responses:                   %10d\n", result.httpResult.status1xxCount)
+	fmt.Fprintf(out, "Number of 2xx responses:                   %10d\n", result.httpResult.status2xxCount)
+	fmt.Fprintf(out, "Number of 3xx responses:                   %10d\n", result.httpResult.status3xxCount)
+	fmt.Fprintf(out, "Number of 4xx responses:                   %10d\n", result.httpResult.status4xxCount)
+	fmt.Fprintf(out, "Number of 5xx responses:                   %10d\n", result.httpResult.status5xxCount)
+	if result.hasExpectations {
+		fmt.Fprintf(out, "Number of failed expectations:             %10d\n", result.httpResult.expectationFailures)
+	}
+
+	printedBrackets := false
+	printBracketsHeader := func() {
+		if !printedBrackets {
+			printedBrackets = true
+			fmt.Fprintln(out)
+			fmt.Fprintf(out, "========= Percentage of responses received within a certain time (ms)======\n")
+			fmt.Fprintln(out)
+		}
+	}
+	for i := 0; i < len(result.httpResult.responseTimesPercent); i++ {
+		if result.httpResult.responseTimesPercent[i][0] > 0 {
+			printBracketsHeader()
+			fmt.Fprintf(out, "%10d%% : %d ms\n", result.httpResult.responseTimesPercent[i][2], result.httpResult.responseTimesPercent[i][0])
+		}
+	}
+	// The requests which timed out make up the last bracket, from the shortest time waited before giving up
+	if result.hasStats && len(censored) > 0 {
+		printBracketsHeader()
+		fmt.Fprintf(out, "%10d%% : >= %d ms (timed out)\n", 100, minimum(censored))
+	}
+	fmt.Fprintln(out)
+
+	if len(result.requestMix) > 0 {
+		fmt.Fprintf(out, "========= Request mix (actual / expected) =================================\n")
+		fmt.Fprintln(out)
+		for i, entry := range result.requestMix {
+			if entry.group == "" {
+				fmt.Fprintf(out, "%10d %6.2f%% / %6.2f%% : %s\n", entry.count, entry.actualPercent, entry.expectedPercent, entry.label)
+				continue
+			}
+			if i == 0 || result.requestMix[i-1].group != entry.group {
+				group := result.groupTotal(entry.group)
+				fmt.Fprintf(out, "%10d %6.2f%% / %6.2f%% : %s/\n", group.count, group.actualPercent, group.expectedPercent, entry.group)
+			}
+			fmt.Fprintf(out, "%10d %6.2f%% / %6.2f%% :   %s\n", entry.count, entry.actualPercent, entry.expectedPercent, entry.label)
+		}
+		fmt.Fprintln(out)
+	}
+
+	if result.scenario != nil {
+		result.printScenarioResults(out)
+	}
+
+	handshakes := result.httpResult.handshakeResult
+	if handshakes.full.count+handshakes.resumed.count+handshakes.failures > 0 {
+		result.printHandshakeResults(out, handshakes)
+	}
+
+	if len(result.metrics) > 0 {
+		fmt.Fprintf(out, "========= Script metrics (count / avg / min / max) ========================\n")
+		fmt.Fprintln(out)
+		for _, metric := range result.metrics {
+			fmt.Fprintf(out, "%10d %10.2f %10.2f %10.2f : %s\n", metric.Count, metric.Average(), metric.Min, metric.Max, metric.Name)
+		}
+		fmt.Fprintln(out)
+	}
+
+	fmt.Fprintf(out, "===========================================================================\n")
+
+}
+
+// groupTotal sums up the entries of the request mix which are in a group
+func (result *Result) groupTotal(group string) requestMixEntry {
+	total := requestMixEntry{label: group, group: group}
+	for _, entry := range result.requestMix {
+		if entry.group == group {
+			total.count += entry.count
+			total.expectedPercent += entry.expectedPercent
+			total.actualPercent += entry.actualPercent
+		}
+	}
+	return total
+}
+
+func (result *Result) printScenarioResults(out io.Writer) {
+	scenarioResult := result.httpResult.scenarioResult
+	fmt.Fprintf(out, "========= Scenario steps (count / failures / avg / min / max ms) ==========\n")
+	fmt.Fprintln(out)
+	for i, step := range result.scenario.steps {
+		if i >= len(scenarioResult.steps) {
+			break
+		}
+		printTimedCounter(out, step.request.name, scenarioResult.steps[i])
+	}
+	fmt.Fprintln(out)
+	printTimedCounter(out, "Whole flow", scenarioResult.flow)
+	fmt.Fprintln(out)
+}
+
+func (result *Result) printHandshakeResults(out io.Writer, handshakes handshakeResult) {
+	fmt.Fprintf(out, "========= TLS handshakes (count / avg / min / max ms) =====================\n")
+	fmt.Fprintln(out)
+	for _, kind := range []struct {
+		label   string
+		counter timedCounter
+	}{{"Full", handshakes.full}, {"Resumed", handshakes.resumed}} {
+		counter := kind.counter
+		fmt.Fprintf(out, "%10d %8.2f %8.2f %8.2f : %s\n", counter.count,
+			milliseconds(counter.averageTime()), milliseconds(counter.minTime), milliseconds(counter.maxTime), kind.label)
+	}
+	fmt.Fprintf(out, "%10d : Failed\n", handshakes.failures)
+	fmt.Fprintln(out)
+	if len(handshakes.negotiated) > 0 {
+		fmt.Fprintf(out, "========= Negotiated TLS parameters =======================================\n")
+		fmt.Fprintln(out)
+		for _, parameters := range handshakes.sortedNegotiated() {
+			fmt.Fprintf(out, "%10d : %s\n", handshakes.negotiated[parameters], parameters)
+		}
+		fmt.Fprintln(out)
+	}
+}
+
+func printTimedCounter(out io.Writer, label string, counter timedCounter) {
+	fmt.Fprintf(out, "%10d %8d %8.2f %8.2f %8.2f : %s\n", counter.count, counter.failures,
+		milliseconds(counter.averageTime()), milliseconds(counter.minTime), milliseconds(counter.maxTime), label)
+}
+
+// hasResponseTimes tells whether response times were measured, or at least bounded by the requests which timed out
+func (result *Result) hasResponseTimes() bool {
+	return result.hasStats && len(result.httpResult.responseTimes)+len(result.httpResult.censoredTimes) > 0
+}
+
+// lowerBound prefixes a value with >= when it is only a lower bound
+func lowerBound(value string, censored bool) string {
+	if censored {
+		return ">= " + value
+	}
+	return value
+}
+
+// minimum returns the smallest of values, which must not be empty
+func minimum(values []int) int {
+	min := values[0]
+	for _, value := range values[1:] {
+		if value < min {
+			min = value
+		}
+	}
+	return min
+}
+
+// maximum returns the largest of values, which must not be empty
+func maximum(values []int) int {
+	max := values[0]
+	for _, value := range values[1:] {
+		if value > max {
+			max = value
+		}
+	}
+	return max
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
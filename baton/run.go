@@ -0,0 +1,195 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Config is the configuration of a run, the zero value of a field meaning the same as an unset command line flag
+type Config struct {
+	URL      string   // The URL to send requests to, or unix:///path/to/app.sock:/path for a unix domain socket
+	Method   string   // The HTTP method of the requests sent to the URL (GET by default)
+	Body     string   // The body of the requests sent to the URL
+	BodyFile string   // A file to read the body of the requests sent to the URL from (instead of Body)
+	Headers  []string // Headers added to every request, as "Name: value"
+
+	Source             RequestSource // Provides the requests to send (instead of a URL or a requests file)
+	RequestsFile       string        // A file to read the requests to send from (instead of a URL)
+	RequestsFormat     string        // The format of the requests file, detected from its extension when empty
+	RequestOrder       string        // The order requests are sent in: random (default, or sequential when replaying recorded timing), sequential, loop or partition
+	TemplateRequests   bool          // Evaluate the template expressions of the requests read from the file or source
+	IgnoreTiming       bool          // Send the requests of access logs and HAR files without their recorded gaps, as in random and loop order
+	ReplaySpeed        float64       // Speed factor applied to the recorded timing (1 by default)
+	HARDomains         []string      // Only load HAR entries for these domains
+	HARContentTypes    []string      // Only load HAR entries whose response has one of these content types
+	OpenAPIServer      string        // Base URL replacing the scheme and host of the server of an OpenAPI document
+	OpenAPITags        []string      // Only load OpenAPI operations with any of these tags
+	OpenAPIExcludeTags []string      // Skip OpenAPI operations with any of these tags
+	PostmanEnvironment string        // Postman environment file used to resolve the variables of a collection
+	LogPattern         string        // Regular expression used to parse access logs
+	LogTarget          string        // Base URL to replay the requests of an access log against
+	ScenarioFile       string        // A scenario to run for every request (instead of a URL or a requests file)
+	DataFiles          []string      // CSV or JSON files whose rows provide variables to templates
+	DataMode           string        // How rows of the data files are used: sequential (default), random, unique or vu
+	Script             string        // A Starlark file generating the requests to send, checking the responses or both
+
+	Concurrency   int           // Number of concurrent virtual users (1 by default)
+	Requests      int           // Number of requests to send (1 by default, or the whole file once in sequential or partition order or when replaying recorded timing)
+	Duration      time.Duration // Time to send requests for (instead of a number of requests)
+	Wait          time.Duration // Time to wait before sending the first request
+	ThinkTime     string        // Think time after each request, e.g. 500ms or uniform:1s,3s
+	Pacing        time.Duration // Target time between the start of two iterations of a virtual user
+	KeepCookies   bool          // Keep the cookies set by responses, separately for each virtual user
+	VUConnections bool          // Give each virtual user a connection of its own
+	Quiet         bool          // Do not log the progress of the run
+
+	IgnoreTLS          bool     // Ignore TLS certificate validation
+	ClientCert         string   // Client certificate, as a PEM file or a PKCS#12 bundle (.p12 or .pfx)
+	ClientKey          string   // Key of the client certificate, as a PEM file (not needed for PKCS#12)
+	ClientCertPassword string   // Password of a PKCS#12 bundle
+	CAFile             string   // PEM bundle of the certificate authorities to trust instead of the system ones
+	TLSServerName      string   // Server name sent with SNI and checked against the certificate of the server
+	TLSMinVersion      string   // Minimum TLS version: 1.0, 1.1, 1.2 or 1.3
+	TLSMaxVersion      string   // Maximum TLS version: 1.0, 1.1, 1.2 or 1.3
+	TLSCipherSuites    []string // Cipher suites offered for TLS 1.2 and below, e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	TLSHandshake       bool     // Open a new connection for every request and report the TLS handshakes
+	TLSResume          bool     // Resume TLS sessions with session tickets (Go cannot resume them by session ID)
+
+	RequestTimeout time.Duration // Time to wait for the response to a request, counted as a timeout when exceeded
+	DialTimeout    time.Duration // Time to wait for a connection to be established
+	ReadTimeout    time.Duration // Time to wait for data when reading a response
+	WriteTimeout   time.Duration // Time to wait when writing a request
+	IdleTimeout    time.Duration // Time after which idle connections are closed (10 seconds by default)
+
+	DisableKeepAlive bool // Close the connection after every request
+	MaxConnsPerHost  int  // Maximum number of connections open to a host (512 by default)
+	MaxConnRequests  int  // Close connections after this many requests, giving each virtual user its own connection
+	Pipeline         int  // Pipeline up to this many requests over each connection, shared by all virtual users
+	PipelineConns    int  // Number of connections requests are pipelined over (1 by default)
+	HTTP2            bool // Send requests over HTTP/2, with TLS for https URLs and with prior knowledge (h2c) for http ones
+	HTTP2Conns       int  // Number of HTTP/2 connections the virtual users are spread over (1 by default)
+	HTTP2Streams     int  // Most concurrent streams per HTTP/2 connection (as many as the server allows by default)
+
+	UnixSocket string // Connect to this unix domain socket instead of the host of the URLs
+
+	Transport Transport    // Sends the requests instead of the built-in HTTP/1.1 client, e.g. NewHTTPTransport(client)
+	Hooks     []Hook       // See every request and response, in order
+	Sinks     []ResultSink // Receive the report at the end of the run
+}
+
+func (config Config) configuration() Configuration {
+	configuration := Configuration{
+		body:               config.Body,
+		caFile:             config.CAFile,
+		clientCert:         config.ClientCert,
+		clientCertPassword: config.ClientCertPassword,
+		clientKey:          config.ClientKey,
+		concurrency:        config.Concurrency,
+		dataFilePath:       config.BodyFile,
+		dataFiles:          strings.Join(config.DataFiles, ","),
+		dataMode:           config.DataMode,
+		dialTimeout:        config.DialTimeout,
+		disableKeepAlive:   config.DisableKeepAlive,
+		duration:           config.Duration,
+		harContentTypes:    strings.Join(config.HARContentTypes, ","),
+		harDomains:         strings.Join(config.HARDomains, ","),
+		headers:            config.Headers,
+		hooks:              config.Hooks,
+		http2:              config.HTTP2,
+		http2Conns:         config.HTTP2Conns,
+		http2Streams:       config.HTTP2Streams,
+		idleTimeout:        config.IdleTimeout,
+		ignoreTLS:          config.IgnoreTLS,
+		keepCookies:        config.KeepCookies,
+		keepTiming:         !config.IgnoreTiming,
+		logPattern:         config.LogPattern,
+		logTarget:          config.LogTarget,
+		maxConnRequests:    config.MaxConnRequests,
+		maxConnsPerHost:    config.MaxConnsPerHost,
+		method:             config.Method,
+		numberOfRequests:   config.Requests,
+		openAPIExcludeTags: strings.Join(config.OpenAPIExcludeTags, ","),
+		openAPIServer:      config.OpenAPIServer,
+		openAPITags:        strings.Join(config.OpenAPITags, ","),
+		pacing:             config.Pacing,
+		pipeline:           config.Pipeline,
+		pipelineConns:      config.PipelineConns,
+		postmanEnvironment: config.PostmanEnvironment,
+		readTimeout:        config.ReadTimeout,
+		replaySpeed:        config.ReplaySpeed,
+		requestsFromFile:   config.RequestsFile,
+		requestsFormat:     config.RequestsFormat,
+		requestOrder:       config.RequestOrder,
+		scenarioFile:       config.ScenarioFile,
+		script:             config.Script,
+		source:             config.Source,
+		suppressOutput:     config.Quiet,
+		templateRequests:   config.TemplateRequests,
+		thinkTime:          config.ThinkTime,
+		timeout:            config.RequestTimeout,
+		tlsCipherSuites:    strings.Join(config.TLSCipherSuites, ","),
+		tlsHandshake:       config.TLSHandshake,
+		tlsMaxVersion:      config.TLSMaxVersion,
+		tlsMinVersion:      config.TLSMinVersion,
+		tlsResume:          config.TLSResume,
+		tlsServerName:      config.TLSServerName,
+		transport:          config.Transport,
+		unixSocket:         config.UnixSocket,
+		url:                config.URL,
+		vuConnections:      config.VUConnections,
+		wait:               config.Wait,
+		writeTimeout:       config.WriteTimeout,
+	}
+	if configuration.method == "" {
+		configuration.method = http.MethodGet
+	}
+	if configuration.concurrency == 0 {
+		configuration.concurrency = 1
+	}
+	if configuration.pipelineConns == 0 {
+		configuration.pipelineConns = 1
+	}
+	if configuration.http2Conns == 0 {
+		configuration.http2Conns = 1
+	}
+	if configuration.replaySpeed == 0 {
+		configuration.replaySpeed = 1
+	}
+	return configuration
+}
+
+// Run runs a load test and returns its report, which is also written to the sinks of the configuration.
+// When the context is cancelled, the run stops early and its error is returned with the report of the requests sent.
+func Run(ctx context.Context, config Config) (Report, error) {
+	baton := &Baton{configuration: config.configuration(), result: *newResult()}
+	err := baton.run(ctx)
+	if err != nil && err != ctx.Err() {
+		return Report{}, err
+	}
+
+	report := newReport(baton.result)
+	for _, sink := range config.Sinks {
+		if sinkErr := sink.Write(report); sinkErr != nil && err == nil {
+			err = sinkErr
+		}
+	}
+	return report, err
+}
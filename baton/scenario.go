@@ -0,0 +1,306 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"regexp"
+	"time"
+)
+
+// scenario is a flow of requests sent one after the other by a virtual user
+type scenario struct {
+	name  string
+	steps []scenarioStep
+}
+
+type scenarioStep struct {
+	request    preLoadedRequest
+	extractors []extractor
+}
+
+// extractor takes a value out of a response, to be used by the templates of later steps
+type extractor struct {
+	name     string
+	jsonPath []interface{}
+	regex    *regexp.Regexp
+	header   string
+}
+
+// scenarioResult holds the statistics of each step of a scenario, and of the flow as a whole
+type scenarioResult struct {
+	steps []timedCounter
+	flow  timedCounter
+}
+
+// timedCounter counts how often something happened, how often it failed and how long it took
+type timedCounter struct {
+	count    int
+	failures int
+	timeSum  time.Duration
+	minTime  time.Duration
+	maxTime  time.Duration
+}
+
+type jsonScenario struct {
+	Name  string     `json:"name"`
+	Steps []jsonStep `json:"steps"`
+}
+
+type jsonStep struct {
+	jsonRequest
+	Extract []jsonExtractor `json:"extract"`
+}
+
+type jsonExtractor struct {
+	Name     string `json:"name"`
+	JSONPath string `json:"jsonPath"`
+	Regex    string `json:"regex"`
+	Header   string `json:"header"`
+}
+
+func (rawExtractor jsonExtractor) toExtractor() (extractor, error) {
+	if rawExtractor.Name == "" {
+		return extractor{}, errors.New("extractors need a name")
+	}
+
+	extractor := extractor{name: rawExtractor.Name, header: rawExtractor.Header}
+	sources := 0
+	if rawExtractor.Header != "" {
+		sources++
+	}
+	if rawExtractor.JSONPath != "" {
+		path, err := parseJSONPath(rawExtractor.JSONPath)
+		if err != nil {
+			return extractor, err
+		}
+		extractor.jsonPath = path
+		sources++
+	}
+	if rawExtractor.Regex != "" {
+		regex, err := regexp.Compile(rawExtractor.Regex)
+		if err != nil {
+			return extractor, err
+		}
+		extractor.regex = regex
+		sources++
+	}
+	if sources != 1 {
+		return extractor, errors.New("extractor " + rawExtractor.Name + " needs exactly one of jsonPath, regex or header")
+	}
+	return extractor, nil
+}
+
+// extract returns the value of the extractor in a response, or false if it could not be found
+func (extractor extractor) extract(resp *Response) (string, bool) {
+	switch {
+	case extractor.header != "":
+		values := resp.Headers.Values(extractor.header)
+		if len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	case extractor.jsonPath != nil:
+		return evaluateJSONPath(resp.Body, extractor.jsonPath)
+	default:
+		match := extractor.regex.FindSubmatch(resp.Body)
+		if match == nil {
+			return "", false
+		}
+		if len(match) > 1 {
+			return string(match[1]), true
+		}
+		return string(match[0]), true
+	}
+}
+
+// loadScenario reads a scenario from a YAML or JSON file
+func loadScenario(filename string, headers [][]string, sequence *uint64) (*scenario, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// The file is decoded as YAML, which JSON is a subset of, and then into the same types as JSON request files
+	var raw interface{}
+	if err := yaml.Unmarshal(contents, &raw); err != nil {
+		return nil, err
+	}
+	normalized, err := json.Marshal(normalizeYAML(raw))
+	if err != nil {
+		return nil, err
+	}
+	var rawScenario jsonScenario
+	if err := json.Unmarshal(normalized, &rawScenario); err != nil {
+		return nil, err
+	}
+	if len(rawScenario.Steps) == 0 {
+		return nil, errors.New("a scenario needs at least one step")
+	}
+
+	scenario := &scenario{name: rawScenario.Name}
+	requests := make([]preLoadedRequest, len(rawScenario.Steps))
+	for i, rawStep := range rawScenario.Steps {
+		request, err := rawStep.toPreLoadedRequest()
+		if err != nil {
+			return nil, fmt.Errorf("step %d: %v", i+1, err)
+		}
+		if request.name == "" {
+			request.name = request.method + " " + request.url
+		}
+		request.headers = addHeaders(request.headers, headers)
+		requests[i] = request
+
+		step := scenarioStep{}
+		for _, rawExtractor := range rawStep.Extract {
+			extractor, err := rawExtractor.toExtractor()
+			if err != nil {
+				return nil, fmt.Errorf("step %d: %v", i+1, err)
+			}
+			step.extractors = append(step.extractors, extractor)
+		}
+		scenario.steps = append(scenario.steps, step)
+	}
+
+	if err := compileRequestTemplates(requests, sequence); err != nil {
+		return nil, err
+	}
+	for i := range requests {
+		scenario.steps[i].request = requests[i]
+	}
+	return scenario, nil
+}
+
+func (counter *timedCounter) record(elapsed time.Duration, failed bool) {
+	if counter.count == 0 || elapsed < counter.minTime {
+		counter.minTime = elapsed
+	}
+	if elapsed > counter.maxTime {
+		counter.maxTime = elapsed
+	}
+	counter.count++
+	counter.timeSum += elapsed
+	if failed {
+		counter.failures++
+	}
+}
+
+func (counter *timedCounter) merge(other timedCounter) {
+	if other.count == 0 {
+		return
+	}
+	if counter.count == 0 || other.minTime < counter.minTime {
+		counter.minTime = other.minTime
+	}
+	if other.maxTime > counter.maxTime {
+		counter.maxTime = other.maxTime
+	}
+	counter.count += other.count
+	counter.failures += other.failures
+	counter.timeSum += other.timeSum
+}
+
+func (counter timedCounter) averageTime() time.Duration {
+	if counter.count == 0 {
+		return 0
+	}
+	return counter.timeSum / time.Duration(counter.count)
+}
+
+func (result *scenarioResult) merge(other scenarioResult) {
+	if len(result.steps) < len(other.steps) {
+		result.steps = append(result.steps, make([]timedCounter, len(other.steps)-len(result.steps))...)
+	}
+	for i := range other.steps {
+		result.steps[i].merge(other.steps[i])
+	}
+	result.flow.merge(other.flow)
+}
+
+// runScenario sends the steps of a scenario once, returning false if it needs data which has run out.
+// Every step counts as a request of the worker, numbered in the order they are sent.
+// The timings of the requests are recorded if a channel is given.
+func (worker *worker) runScenario(scenario *scenario, timings chan int) bool {
+	data, ok := worker.templateData()
+	if !ok {
+		return false
+	}
+
+	result := &worker.httpResult.scenarioResult
+	if len(result.steps) != len(scenario.steps) {
+		result.steps = make([]timedCounter, len(scenario.steps))
+	}
+
+	flowStart := time.Now()
+	for i, step := range scenario.steps {
+		request := step.request
+		worker.requestNumber++
+		data["requestNumber"] = worker.requestNumber
+		if request.template != nil {
+			var err error
+			if request, err = request.template.render(request, data); err != nil {
+				// The step is not sent, which ends the iteration like any other failed step
+				worker.httpResult.templateErrorCount++
+				result.steps[i].record(0, true)
+				result.flow.record(time.Since(flowStart), true)
+				return true
+			}
+		}
+		req := newOutgoingRequest(request)
+
+		stepStart := time.Now()
+		var resp *Response
+		var failed bool
+		if timings != nil {
+			resp, failed = worker.performRequestWithStats(req, timings)
+		} else {
+			resp, failed = worker.performRequest(req)
+		}
+		elapsed := time.Since(stepStart)
+
+		if !failed && worker.checkResponse(request.expect, req, resp) {
+			failed = true
+		}
+		for _, extractor := range step.extractors {
+			if failed {
+				break
+			}
+			var value string
+			if value, ok = extractor.extract(resp); ok {
+				data[extractor.name] = value
+				worker.virtualUser.variables[extractor.name] = value
+			}
+			failed = !ok
+		}
+
+		result.steps[i].record(elapsed, failed)
+		if failed {
+			result.flow.record(time.Since(flowStart), true)
+			return true
+		}
+		if i < len(scenario.steps)-1 {
+			worker.think()
+		}
+	}
+
+	result.flow.record(time.Since(flowStart), false)
+	return true
+}
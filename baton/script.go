@@ -0,0 +1,331 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"errors"
+	"fmt"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkjson"
+	"go.starlark.net/starlarkstruct"
+	"log"
+	"sort"
+	"sync"
+)
+
+// script is a Starlark file which can generate the requests to send and check the responses
+type script struct {
+	nextRequest   starlark.Callable // next_request(vu), returning a request or None to stop the virtual user
+	checkResponse starlark.Callable // check_response(response, vu), returning False or an error message for failures
+	shared        map[string]starlark.Value
+	sharedMutex   sync.Mutex
+	metrics       map[string]*Metric
+	metricsMutex  sync.Mutex
+	logger        *log.Logger // Prints the output of print() and the errors of the script
+}
+
+// scriptRunner runs a script on behalf of a virtual user
+type scriptRunner struct {
+	script        *script
+	thread        *starlark.Thread
+	vars          *starlark.Dict // Variables kept by the virtual user between calls
+	workerID      int
+	reportedError bool
+}
+
+// Metric sums up the values recorded by a script under a name
+type Metric struct {
+	Name  string
+	Count int
+	Sum   float64
+	Min   float64
+	Max   float64
+}
+
+// Average returns the mean of the values recorded
+func (metric Metric) Average() float64 {
+	if metric.Count == 0 {
+		return 0
+	}
+	return metric.Sum / float64(metric.Count)
+}
+
+func (script *script) print(thread *starlark.Thread, msg string) {
+	script.logger.Println(msg)
+}
+
+func loadScript(filename string, logger *log.Logger) (*script, error) {
+	script := &script{shared: make(map[string]starlark.Value), metrics: make(map[string]*Metric), logger: logger}
+	predeclared := starlark.StringDict{
+		"build_request": starlark.NewBuiltin("build_request", buildRequestBuiltin),
+		"json":          starlarkjson.Module,
+		"metric":        starlark.NewBuiltin("metric", script.metricBuiltin),
+		"shared": &starlarkstruct.Module{Name: "shared", Members: starlark.StringDict{
+			"get":  starlark.NewBuiltin("shared.get", script.sharedGet),
+			"set":  starlark.NewBuiltin("shared.set", script.sharedSet),
+			"incr": starlark.NewBuiltin("shared.incr", script.sharedIncr),
+		}},
+		"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
+	}
+
+	thread := &starlark.Thread{Name: "load", Print: script.print}
+	globals, err := starlark.ExecFile(thread, filename, nil, predeclared)
+	if err != nil {
+		return nil, err
+	}
+
+	var ok bool
+	if value, found := globals["next_request"]; found {
+		if script.nextRequest, ok = value.(starlark.Callable); !ok {
+			return nil, errors.New("next_request is not a function")
+		}
+	}
+	if value, found := globals["check_response"]; found {
+		if script.checkResponse, ok = value.(starlark.Callable); !ok {
+			return nil, errors.New("check_response is not a function")
+		}
+	}
+	if script.nextRequest == nil && script.checkResponse == nil {
+		return nil, errors.New("a script has to define next_request, check_response or both")
+	}
+	return script, nil
+}
+
+func newScriptRunner(script *script, workerID int) *scriptRunner {
+	thread := &starlark.Thread{Name: fmt.Sprintf("worker %d", workerID), Print: script.print}
+	return &scriptRunner{script, thread, starlark.NewDict(0), workerID, false}
+}
+
+func (runner *scriptRunner) virtualUser(iteration int) starlark.Value {
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"id":        starlark.MakeInt(runner.workerID),
+		"iteration": starlark.MakeInt(iteration),
+		"vars":      runner.vars,
+	})
+}
+
+// reportError logs the first error of the script for the virtual user, as the following ones are likely the same
+func (runner *scriptRunner) reportError(err error) {
+	if !runner.reportedError {
+		runner.reportedError = true
+		runner.script.logger.Printf("Script error in worker %d: %v\n", runner.workerID, err)
+	}
+}
+
+// nextRequest returns the request generated by the script, or false when there are no more requests to send
+func (runner *scriptRunner) nextRequest(defaults preLoadedRequest, iteration int) (preLoadedRequest, bool) {
+	value, err := starlark.Call(runner.thread, runner.script.nextRequest, starlark.Tuple{runner.virtualUser(iteration)}, nil)
+	if err != nil {
+		runner.reportError(err)
+		return preLoadedRequest{}, false
+	}
+	if value == starlark.None {
+		return preLoadedRequest{}, false
+	}
+	request, err := toScriptedRequest(value, defaults)
+	if err != nil {
+		runner.reportError(fmt.Errorf("next_request: %v", err))
+		return preLoadedRequest{}, false
+	}
+	return request, true
+}
+
+// checkResponse returns true if the script considers the response a failure
+func (runner *scriptRunner) checkResponse(request *OutgoingRequest, resp *Response, iteration int) bool {
+	names := make([]string, 0, len(resp.Headers))
+	for name := range resp.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	headers := starlark.NewDict(len(names))
+	for _, name := range names {
+		values := resp.Headers[name]
+		headers.SetKey(starlark.String(name), starlark.String(values[len(values)-1]))
+	}
+	response := starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"status":  starlark.MakeInt(resp.StatusCode),
+		"body":    starlark.String(resp.Body),
+		"headers": headers,
+		"url":     starlark.String(request.URL),
+		"method":  starlark.String(request.Method),
+	})
+
+	value, err := starlark.Call(runner.thread, runner.script.checkResponse, starlark.Tuple{response, runner.virtualUser(iteration)}, nil)
+	if err != nil {
+		runner.reportError(err)
+		return true
+	}
+	switch result := value.(type) {
+	case starlark.NoneType:
+		return false
+	case starlark.Bool:
+		return !bool(result)
+	case starlark.String:
+		return result != ""
+	default:
+		runner.reportError(fmt.Errorf("check_response returned a %s instead of a bool, a string or None", value.Type()))
+		return true
+	}
+}
+
+func toScriptedRequest(value starlark.Value, defaults preLoadedRequest) (preLoadedRequest, error) {
+	dict, ok := value.(*starlark.Dict)
+	if !ok {
+		return preLoadedRequest{}, fmt.Errorf("expected a request built with build_request, got a %s", value.Type())
+	}
+	request := preLoadedRequest{method: defaults.method, url: defaults.url, body: defaults.body, headers: defaults.headers, weight: 1}
+	fields := map[string]*string{"method": &request.method, "url": &request.url, "body": &request.body}
+	for _, item := range dict.Items() {
+		key, _ := starlark.AsString(item[0])
+		if field, found := fields[key]; found {
+			text, ok := starlark.AsString(item[1])
+			if !ok {
+				return preLoadedRequest{}, fmt.Errorf("%s is a %s, not a string", key, item[1].Type())
+			}
+			*field = text
+			continue
+		}
+		switch key {
+		case "headers":
+			headers, ok := item[1].(*starlark.Dict)
+			if !ok {
+				return preLoadedRequest{}, errors.New("headers is not a dict")
+			}
+			request.headers = nil
+			for _, header := range headers.Items() {
+				name, nameOK := starlark.AsString(header[0])
+				headerValue, valueOK := starlark.AsString(header[1])
+				if !nameOK || !valueOK {
+					return preLoadedRequest{}, errors.New("header names and values have to be strings")
+				}
+				request.headers = append(request.headers, []string{name, headerValue})
+			}
+		default:
+			return preLoadedRequest{}, errors.New("unknown request field: " + key)
+		}
+	}
+	return request, nil
+}
+
+// buildRequestBuiltin implements build_request(url, method="GET", body="", headers={})
+func buildRequestBuiltin(thread *starlark.Thread, builtin *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var url, method, body string
+	headers := starlark.NewDict(0)
+	method = "GET"
+	if err := starlark.UnpackArgs(builtin.Name(), args, kwargs, "url", &url, "method?", &method, "body?", &body, "headers?", &headers); err != nil {
+		return nil, err
+	}
+	request := starlark.NewDict(4)
+	request.SetKey(starlark.String("url"), starlark.String(url))
+	request.SetKey(starlark.String("method"), starlark.String(method))
+	request.SetKey(starlark.String("body"), starlark.String(body))
+	request.SetKey(starlark.String("headers"), headers)
+	return request, nil
+}
+
+// metricBuiltin implements metric(name, value), recording a value of a custom metric
+func (script *script) metricBuiltin(thread *starlark.Thread, builtin *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var value starlark.Value
+	if err := starlark.UnpackArgs(builtin.Name(), args, kwargs, "name", &name, "value", &value); err != nil {
+		return nil, err
+	}
+	number, ok := starlark.AsFloat(value)
+	if !ok {
+		return nil, fmt.Errorf("%s: value is a %s, not a number", builtin.Name(), value.Type())
+	}
+
+	script.metricsMutex.Lock()
+	defer script.metricsMutex.Unlock()
+	metric, found := script.metrics[name]
+	if !found {
+		metric = &Metric{Name: name, Min: number, Max: number}
+		script.metrics[name] = metric
+	}
+	metric.Count++
+	metric.Sum += number
+	if number < metric.Min {
+		metric.Min = number
+	}
+	if number > metric.Max {
+		metric.Max = number
+	}
+	return starlark.None, nil
+}
+
+// sortedMetrics returns the metrics recorded by the script, by name
+func (script *script) sortedMetrics() []Metric {
+	script.metricsMutex.Lock()
+	defer script.metricsMutex.Unlock()
+	metrics := make([]Metric, 0, len(script.metrics))
+	for _, metric := range script.metrics {
+		metrics = append(metrics, *metric)
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Name < metrics[j].Name
+	})
+	return metrics
+}
+
+// sharedGet implements shared.get(key, default=None)
+func (script *script) sharedGet(thread *starlark.Thread, builtin *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key string
+	var defaultValue starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(builtin.Name(), args, kwargs, "key", &key, "default?", &defaultValue); err != nil {
+		return nil, err
+	}
+	script.sharedMutex.Lock()
+	defer script.sharedMutex.Unlock()
+	if value, found := script.shared[key]; found {
+		return value, nil
+	}
+	return defaultValue, nil
+}
+
+// sharedSet implements shared.set(key, value), the value being frozen as all the virtual users can read it
+func (script *script) sharedSet(thread *starlark.Thread, builtin *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key string
+	var value starlark.Value
+	if err := starlark.UnpackArgs(builtin.Name(), args, kwargs, "key", &key, "value", &value); err != nil {
+		return nil, err
+	}
+	value.Freeze()
+	script.sharedMutex.Lock()
+	defer script.sharedMutex.Unlock()
+	script.shared[key] = value
+	return starlark.None, nil
+}
+
+// sharedIncr implements shared.incr(key, delta=1), returning the new value of a shared counter
+func (script *script) sharedIncr(thread *starlark.Thread, builtin *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key string
+	delta := 1
+	if err := starlark.UnpackArgs(builtin.Name(), args, kwargs, "key", &key, "delta?", &delta); err != nil {
+		return nil, err
+	}
+	script.sharedMutex.Lock()
+	defer script.sharedMutex.Unlock()
+	current := 0
+	if value, found := script.shared[key]; found {
+		var err error
+		if current, err = starlark.AsInt32(value); err != nil {
+			return nil, fmt.Errorf("%s: %s is not a counter", builtin.Name(), key)
+		}
+	}
+	script.shared[key] = starlark.MakeInt(current + delta)
+	return script.shared[key], nil
+}
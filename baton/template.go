@@ -0,0 +1,182 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+)
+
+const randomStringCharacters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// requestTemplate holds the parsed templates of a request whose URL, headers or body contain template expressions
+type requestTemplate struct {
+	url     *template.Template
+	body    *template.Template
+	headers []*template.Template // One per header value, nil when the value is not a template
+}
+
+// newTemplateFuncs returns the functions available to templates, with a sequence shared by all the templates of a run
+func newTemplateFuncs(sequence *uint64) template.FuncMap {
+	return template.FuncMap{
+		"randInt": func(min int, max int) int {
+			if max <= min {
+				return min
+			}
+			return min + mathrand.Intn(max-min+1)
+		},
+		"randString": func(length int) string {
+			randomString := make([]byte, length)
+			for i := range randomString {
+				randomString[i] = randomStringCharacters[mathrand.Intn(len(randomStringCharacters))]
+			}
+			return string(randomString)
+		},
+		"uuid": func() string {
+			uuid := make([]byte, 16)
+			rand.Read(uuid)
+			uuid[6] = (uuid[6] & 0x0f) | 0x40
+			uuid[8] = (uuid[8] & 0x3f) | 0x80
+			return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+		},
+		"timestamp": func() int64 {
+			return time.Now().Unix()
+		},
+		"timestampMs": func() int64 {
+			return time.Now().UnixNano() / int64(time.Millisecond)
+		},
+		"now": func() string {
+			return time.Now().UTC().Format(time.RFC3339)
+		},
+		"seq": func() uint64 {
+			return atomic.AddUint64(sequence, 1)
+		},
+		"choice": func(values ...string) string {
+			if len(values) == 0 {
+				return ""
+			}
+			return values[mathrand.Intn(len(values))]
+		},
+		"base64": func(value string) string {
+			return base64.StdEncoding.EncodeToString([]byte(value))
+		},
+		"hex": func(value string) string {
+			return hex.EncodeToString([]byte(value))
+		},
+	}
+}
+
+func isTemplate(text string) bool {
+	return strings.Contains(text, "{{")
+}
+
+func parseTemplate(name string, text string, funcs template.FuncMap) (*template.Template, error) {
+	if !isTemplate(text) {
+		return nil, nil
+	}
+	return template.New(name).Funcs(funcs).Parse(text)
+}
+
+// compileRequestTemplate parses the template expressions of a request, returning nil if it has none
+func compileRequestTemplate(request preLoadedRequest, funcs template.FuncMap) (*requestTemplate, error) {
+	var err error
+	requestTemplate := &requestTemplate{headers: make([]*template.Template, len(request.headers))}
+	templated := false
+
+	if requestTemplate.url, err = parseTemplate("url", request.url, funcs); err != nil {
+		return nil, err
+	}
+	if requestTemplate.body, err = parseTemplate("body", request.body, funcs); err != nil {
+		return nil, err
+	}
+	templated = requestTemplate.url != nil || requestTemplate.body != nil
+
+	for i, header := range request.headers {
+		if requestTemplate.headers[i], err = parseTemplate(header[0], header[1], funcs); err != nil {
+			return nil, err
+		}
+		templated = templated || requestTemplate.headers[i] != nil
+	}
+
+	if !templated {
+		return nil, nil
+	}
+	return requestTemplate, nil
+}
+
+// compileRequestTemplates parses the templates of all the requests, trying each of them once so mistakes are found before the run
+func compileRequestTemplates(requests []preLoadedRequest, sequence *uint64) error {
+	funcs := newTemplateFuncs(sequence)
+	// Trying the templates must not use up any of the sequence
+	defer atomic.StoreUint64(sequence, 0)
+
+	for i := range requests {
+		requestTemplate, err := compileRequestTemplate(requests[i], funcs)
+		if err != nil {
+			return err
+		}
+		if requestTemplate == nil {
+			continue
+		}
+		if _, err := requestTemplate.render(requests[i], map[string]interface{}{"workerID": 0, "requestNumber": 0}); err != nil {
+			return err
+		}
+		requests[i].template = requestTemplate
+	}
+	return nil
+}
+
+func executeTemplate(tmpl *template.Template, text string, data map[string]interface{}) (string, error) {
+	if tmpl == nil {
+		return text, nil
+	}
+	var buffer bytes.Buffer
+	if err := tmpl.Execute(&buffer, data); err != nil {
+		return text, err
+	}
+	return buffer.String(), nil
+}
+
+// render returns a copy of the request with all of its template expressions evaluated
+func (requestTemplate *requestTemplate) render(request preLoadedRequest, data map[string]interface{}) (preLoadedRequest, error) {
+	var err error
+	if request.url, err = executeTemplate(requestTemplate.url, request.url, data); err != nil {
+		return request, err
+	}
+	if request.body, err = executeTemplate(requestTemplate.body, request.body, data); err != nil {
+		return request, err
+	}
+
+	headers := make([][]string, len(request.headers))
+	for i, header := range request.headers {
+		value, err := executeTemplate(requestTemplate.headers[i], header[1], data)
+		if err != nil {
+			return request, err
+		}
+		headers[i] = []string{header[0], value}
+	}
+	request.headers = headers
+	return request, nil
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"context"
+	"time"
+)
+
+// TimedWorker implements a worker which sends requests for a predetermined duration
+type timedWorker struct {
+	*worker
+	durationToRun time.Duration
+}
+
+func newTimedWorker(ctx context.Context, id int, requests <-chan bool, results chan<- HTTPResult, done chan<- bool, durationToRun time.Duration) *timedWorker {
+	worker := newWorker(ctx, id, requests, results, done)
+	return &timedWorker{worker, durationToRun}
+}
+
+func (worker timedWorker) sendRequest(request preLoadedRequest) {
+	var req *OutgoingRequest
+	startTime := time.Now()
+	worker.deadline = startTime.Add(worker.durationToRun)
+
+	for {
+		if time.Since(startTime) >= worker.durationToRun || worker.stopped() {
+			break
+		}
+		iterationStart := time.Now()
+
+		// The same request is sent over and over, unless it has to be built again every time
+		if req == nil || !worker.reusable(request) {
+			var ok bool
+			if req, ok = worker.buildRequest(request); !ok {
+				break
+			}
+		}
+		if req == nil {
+			worker.pace(iterationStart)
+			continue
+		}
+		if resp, failed := worker.performRequest(req); !failed {
+			worker.checkResponse(nil, req, resp)
+		}
+		worker.pace(iterationStart)
+	}
+
+	worker.finish()
+}
+
+func (worker timedWorker) sendRequests(requests []preLoadedRequest, selector requestSelector) {
+	startTime := time.Now()
+	worker.deadline = startTime.Add(worker.durationToRun)
+
+	for {
+		if time.Since(startTime) >= worker.durationToRun || worker.stopped() {
+			break
+		}
+		iterationStart := time.Now()
+		request, ok := worker.nextRequest(requests, selector)
+		if !ok {
+			break
+		}
+		req, ok := worker.buildRequest(request)
+		if !ok {
+			break
+		}
+		if req == nil {
+			worker.pace(iterationStart)
+			continue
+		}
+		if resp, failed := worker.performRequest(req); !failed {
+			worker.checkResponse(request.expect, req, resp)
+		}
+		worker.pace(iterationStart)
+	}
+
+	worker.finish()
+}
+
+func (worker timedWorker) sendScenario(scenario *scenario) {
+	startTime := time.Now()
+	worker.deadline = startTime.Add(worker.durationToRun)
+
+	for {
+		if time.Since(startTime) >= worker.durationToRun || worker.stopped() {
+			break
+		}
+		iterationStart := time.Now()
+		if !worker.runScenario(scenario, nil) {
+			break
+		}
+		worker.pace(iterationStart)
+	}
+
+	worker.finish()
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"golang.org/x/crypto/pkcs12"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion parses a TLS version such as 1.2, returning 0 when it is empty
+func parseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return 0, nil
+	}
+	if value, ok := tlsVersions[version]; ok {
+		return value, nil
+	}
+	return 0, errors.New("unknown TLS version: " + version + " (expected 1.0, 1.1, 1.2 or 1.3)")
+}
+
+// parseCipherSuites parses comma separated cipher suite names, such as TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+func parseCipherSuites(names string) ([]uint16, error) {
+	if names == "" {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		known[suite.Name] = suite.ID
+	}
+
+	var suites []uint16
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		id, ok := known[name]
+		if !ok {
+			return nil, errors.New("unknown cipher suite: " + name)
+		}
+		suites = append(suites, id)
+	}
+	return suites, nil
+}
+
+// isPKCS12 tells whether a client certificate is a PKCS#12 bundle rather than a PEM file
+func isPKCS12(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".p12", ".pfx":
+		return true
+	}
+	return false
+}
+
+// loadClientCertificate loads a client certificate and its key, either from PEM files or from a PKCS#12 bundle
+func loadClientCertificate(configuration Configuration) (tls.Certificate, error) {
+	if !isPKCS12(configuration.clientCert) {
+		return tls.LoadX509KeyPair(configuration.clientCert, configuration.clientKey)
+	}
+
+	data, err := ioutil.ReadFile(configuration.clientCert)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	blocks, err := pkcs12.ToPEM(data, configuration.clientCertPassword)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	var certificates, key []byte
+	for _, block := range blocks {
+		if block.Type == "CERTIFICATE" {
+			certificates = append(certificates, pem.EncodeToMemory(block)...)
+		} else {
+			key = append(key, pem.EncodeToMemory(block)...)
+		}
+	}
+	return tls.X509KeyPair(certificates, key)
+}
+
+// newTLSConfig builds the TLS configuration of the client, or returns nil when the defaults are used
+func newTLSConfig(configuration Configuration) (*tls.Config, error) {
+	if !configuration.ignoreTLS && configuration.caFile == "" && configuration.clientCert == "" && configuration.tlsServerName == "" &&
+		configuration.tlsMinVersion == "" && configuration.tlsMaxVersion == "" && configuration.tlsCipherSuites == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: configuration.ignoreTLS, ServerName: configuration.tlsServerName}
+
+	if configuration.clientCert != "" {
+		certificate, err := loadClientCertificate(configuration)
+		if err != nil {
+			return nil, errors.New("failed to load client certificate: " + err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if configuration.caFile != "" {
+		data, err := ioutil.ReadFile(configuration.caFile)
+		if err != nil {
+			return nil, errors.New("failed to load CA bundle: " + err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificates found in CA bundle: " + configuration.caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	var err error
+	if tlsConfig.MinVersion, err = parseTLSVersion(configuration.tlsMinVersion); err != nil {
+		return nil, err
+	}
+	if tlsConfig.MaxVersion, err = parseTLSVersion(configuration.tlsMaxVersion); err != nil {
+		return nil, err
+	}
+	if tlsConfig.CipherSuites, err = parseCipherSuites(configuration.tlsCipherSuites); err != nil {
+		return nil, err
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"context"
+	"github.com/valyala/fasthttp"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Transport sends the requests of a run. The built-in HTTP/1.1, pipelining, HTTP/2 and TLS handshake clients are
+// transports, and Config.Transport replaces them. A transport given in the configuration is shared by all the
+// virtual users, so it has to be safe for concurrent use. An error counts as a connection error, or as a timeout when
+// it is a net.Error which timed out.
+type Transport interface {
+	// RoundTrip sends a request and returns its response, giving up when the context is done
+	RoundTrip(ctx context.Context, request *OutgoingRequest) (*Response, error)
+}
+
+// OutgoingRequest is a request as a virtual user sends it, with its templates rendered, which a Transport and the
+// hooks get
+type OutgoingRequest struct {
+	Method  string
+	URL     string
+	Body    string
+	Headers http.Header
+}
+
+// Response is a response returned by a Transport
+type Response struct {
+	StatusCode int
+	Headers    http.Header
+	Body       []byte
+}
+
+// TransportFunc is a Transport made of a function
+type TransportFunc func(ctx context.Context, request *OutgoingRequest) (*Response, error)
+
+// RoundTrip calls the function
+func (roundTrip TransportFunc) RoundTrip(ctx context.Context, request *OutgoingRequest) (*Response, error) {
+	return roundTrip(ctx, request)
+}
+
+type httpTransport struct {
+	client *http.Client
+}
+
+// NewHTTPTransport returns a Transport which sends requests with a client of the net/http package. Redirects are
+// returned rather than followed, like the built-in client does.
+func NewHTTPTransport(client *http.Client) Transport {
+	noRedirects := *client
+	noRedirects.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &httpTransport{&noRedirects}
+}
+
+func (transport *httpTransport) RoundTrip(ctx context.Context, request *OutgoingRequest) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, request.Method, request.URL, strings.NewReader(request.Body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range request.Headers {
+		switch name {
+		case "Host":
+			req.Host = values[0]
+		case "Connection":
+			req.Close = strings.EqualFold(values[0], "close")
+		default:
+			req.Header[name] = values
+		}
+	}
+
+	resp, err := transport.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{resp.StatusCode, resp.Header, body}, nil
+}
+
+// httpClient sends requests, like the clients of fasthttp do
+type httpClient interface {
+	Do(req *fasthttp.Request, resp *fasthttp.Response) error
+	DoTimeout(req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error
+}
+
+// fastHTTPTransport sends requests with a client of fasthttp, which is how the requests of a run are sent unless they
+// are pipelined, sent over HTTP/2 or given their own connections in TLS handshake mode
+type fastHTTPTransport struct {
+	client       httpClient
+	readTimedOut *uint32 // Set by the connections of the client when a read times out (nil if they are shared)
+}
+
+// readTimeoutError is returned instead of the error of a request when a read timed out before the first byte of the
+// response, which the client reports as the connection being closed
+type readTimeoutError struct {
+	err error
+}
+
+func (err readTimeoutError) Error() string   { return "read timeout: " + err.err.Error() }
+func (err readTimeoutError) Timeout() bool   { return true }
+func (err readTimeoutError) Temporary() bool { return true }
+
+type fastHTTPResult struct {
+	response *Response
+	err      error
+}
+
+func (transport *fastHTTPTransport) RoundTrip(ctx context.Context, request *OutgoingRequest) (*Response, error) {
+	if ctx.Done() == nil {
+		return transport.roundTrip(ctx, request)
+	}
+	// The clients of fasthttp cannot be interrupted, so the request is left to finish on its own when the context is
+	// done first
+	results := make(chan fastHTTPResult, 1)
+	go func() {
+		response, err := transport.roundTrip(ctx, request)
+		results <- fastHTTPResult{response, err}
+	}()
+	select {
+	case result := <-results:
+		return result.response, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (transport *fastHTTPTransport) roundTrip(ctx context.Context, request *OutgoingRequest) (*Response, error) {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+	setFastHTTPRequest(req, request)
+
+	if transport.readTimedOut != nil {
+		atomic.StoreUint32(transport.readTimedOut, 0)
+	}
+	var err error
+	if deadline, ok := ctx.Deadline(); ok {
+		err = transport.client.DoTimeout(req, resp, time.Until(deadline))
+	} else {
+		err = transport.client.Do(req, resp)
+	}
+	if err != nil {
+		if transport.readTimedOut != nil && atomic.LoadUint32(transport.readTimedOut) == 1 {
+			return nil, readTimeoutError{err}
+		}
+		return nil, err
+	}
+	return newFastHTTPResponse(resp), nil
+}
+
+// setFastHTTPRequest copies a request into one of fasthttp
+func setFastHTTPRequest(req *fasthttp.Request, request *OutgoingRequest) {
+	req.SetRequestURI(request.URL)
+	req.Header.SetMethod(request.Method)
+	req.SetBodyString(request.Body)
+	for name, values := range request.Headers {
+		for _, value := range values {
+			switch name {
+			case "Content-Type":
+				req.Header.SetContentType(value)
+			case "Content-Length":
+				// Set with the body
+			case "Connection":
+				if strings.EqualFold(value, "close") {
+					req.SetConnectionClose()
+				}
+			default:
+				req.Header.Add(name, value)
+			}
+		}
+	}
+}
+
+// newFastHTTPResponse copies a response of fasthttp, which is released once the request is done
+func newFastHTTPResponse(resp *fasthttp.Response) *Response {
+	headers := http.Header{}
+	resp.Header.VisitAll(func(key, value []byte) {
+		headers.Add(string(key), string(value))
+	})
+	return &Response{resp.StatusCode(), headers, append([]byte(nil), resp.Body()...)}
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	neturl "net/url"
+	"strings"
+)
+
+// virtualUser holds the state of a simulated user, which a worker keeps between its requests
+type virtualUser struct {
+	id        int
+	cookies   *cookiejar.Jar    // Cookies received by the user (nil if cookies are ignored)
+	variables map[string]string // Values extracted from responses, available to templates
+}
+
+func newVirtualUser(id int, keepCookies bool) *virtualUser {
+	var cookies *cookiejar.Jar
+	if keepCookies {
+		// A jar is only ever used by a single worker, and creating it cannot fail without options
+		cookies, _ = cookiejar.New(nil)
+	}
+	return &virtualUser{id, cookies, map[string]string{}}
+}
+
+// addCookies sets the cookies the user has for the URL of a request, after those the request already has
+func (user *virtualUser) addCookies(request *OutgoingRequest) {
+	if user.cookies == nil {
+		return
+	}
+	url, err := neturl.Parse(request.URL)
+	if err != nil {
+		return
+	}
+	cookies := user.cookies.Cookies(url)
+	if len(cookies) == 0 {
+		return
+	}
+	values := make([]string, 0, len(cookies)+1)
+	if existing := request.Headers.Get("Cookie"); existing != "" {
+		values = append(values, existing)
+	}
+	for _, cookie := range cookies {
+		values = append(values, cookie.String())
+	}
+	request.Headers.Set("Cookie", strings.Join(values, "; "))
+}
+
+// storeCookies keeps the cookies set by a response, following their domain, path and expiry
+func (user *virtualUser) storeCookies(request *OutgoingRequest, response *Response) {
+	if user.cookies == nil || len(response.Headers["Set-Cookie"]) == 0 {
+		return
+	}
+	url, err := neturl.Parse(request.URL)
+	if err != nil {
+		return
+	}
+	user.cookies.SetCookies(url, (&http.Response{Header: response.Headers}).Cookies())
+}
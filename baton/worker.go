@@ -0,0 +1,346 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package baton
+
+import (
+	"context"
+	"github.com/valyala/fasthttp"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type worker struct {
+	id            int
+	requestNumber int
+	httpResult    HTTPResult
+	transport     Transport
+	virtualUser   *virtualUser
+	dataFeeders   []*dataFeeder
+	hooks         []Hook
+	script        *scriptRunner
+	timeout       time.Duration
+	connLimit     int
+	connRequests  int
+	pacing        pacing
+	deadline      time.Time
+	ctx           context.Context
+	requests      <-chan bool
+	httpResults   chan<- HTTPResult
+	done          chan<- bool
+}
+
+type workable interface {
+	sendRequests(requests []preLoadedRequest, selector requestSelector)
+	sendRequest(request preLoadedRequest)
+	sendScenario(scenario *scenario)
+	setTransport(transport Transport)
+	setDataFeeders(dataFeeders []*dataFeeder)
+	setVirtualUser(virtualUser *virtualUser)
+	setPacing(pacing pacing)
+	setHooks(hooks []Hook)
+	setScript(script *scriptRunner)
+	setTimeout(timeout time.Duration)
+	setConnLimit(connLimit int)
+}
+
+func (worker *worker) setTransport(transport Transport) {
+	worker.transport = transport
+}
+
+func (worker *worker) setDataFeeders(dataFeeders []*dataFeeder) {
+	worker.dataFeeders = dataFeeders
+}
+
+func (worker *worker) setVirtualUser(virtualUser *virtualUser) {
+	worker.virtualUser = virtualUser
+}
+
+func (worker *worker) setPacing(pacing pacing) {
+	worker.pacing = pacing
+}
+
+func (worker *worker) setHooks(hooks []Hook) {
+	worker.hooks = hooks
+}
+
+func (worker *worker) setScript(script *scriptRunner) {
+	worker.script = script
+}
+
+func (worker *worker) setTimeout(timeout time.Duration) {
+	worker.timeout = timeout
+}
+
+// setConnLimit makes the worker close its connection after connLimit requests, unless it is 0
+func (worker *worker) setConnLimit(connLimit int) {
+	worker.connLimit = connLimit
+}
+
+func newWorker(ctx context.Context, id int, requests <-chan bool, httpResults chan<- HTTPResult, done chan<- bool) *worker {
+	return &worker{id, 0, *newHTTPResult(), &fastHTTPTransport{&fasthttp.Client{}, nil}, newVirtualUser(id, false), nil, nil, nil, 0, 0, 0, pacing{}, time.Time{}, ctx, requests, httpResults, done}
+}
+
+// stopped tells whether the run was cancelled. The deadline of the run is checked as well, as the requests which
+// time out with it may return before the context is done.
+func (worker *worker) stopped() bool {
+	if deadline, ok := worker.ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return true
+	}
+	select {
+	case <-worker.ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// do sends a request on behalf of the worker's virtual user
+func (worker *worker) do(request *OutgoingRequest) (*Response, error) {
+	worker.virtualUser.addCookies(request)
+	for _, hook := range worker.hooks {
+		hook.BeforeRequest(request)
+	}
+	if worker.connLimit > 0 {
+		worker.connRequests++
+		if worker.connRequests == worker.connLimit {
+			request.Headers.Set("Connection", "close")
+			worker.connRequests = 0
+		} else {
+			request.Headers.Del("Connection")
+		}
+	}
+	// Cancelling the run interrupts the requests in flight
+	ctx := worker.ctx
+	if worker.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, worker.timeout)
+		defer cancel()
+	}
+	response, err := worker.transport.RoundTrip(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	worker.virtualUser.storeCookies(request, response)
+	return response, nil
+}
+
+// reusable tells whether a request can be built once and sent over and over
+func (worker *worker) reusable(request preLoadedRequest) bool {
+	return request.template == nil && worker.virtualUser.cookies == nil && len(worker.hooks) == 0 && worker.script == nil
+}
+
+// isTimeout tells whether a request failed because it took too long, when connecting or waiting for the response
+func isTimeout(err error) bool {
+	if err == fasthttp.ErrTimeout || err == fasthttp.ErrDialTimeout {
+		return true
+	}
+	if netErr, ok := err.(net.Error); ok {
+		return netErr.Timeout()
+	}
+	// Errors when reading the response are wrapped into errors which only keep the message
+	return strings.HasSuffix(err.Error(), os.ErrDeadlineExceeded.Error())
+}
+
+func (worker *worker) recordError(err error) {
+	if worker.stopped() {
+		// The request was interrupted by the end of the run, rather than failing
+		return
+	}
+	if isTimeout(err) {
+		worker.httpResult.timeoutCount++
+	} else {
+		worker.httpResult.connectionErrorCount++
+	}
+}
+
+func (worker *worker) performRequest(request *OutgoingRequest) (*Response, bool) {
+	response, err := worker.do(request)
+	if err != nil {
+		worker.recordError(err)
+		return nil, true
+	}
+	status := response.StatusCode
+
+	worker.recordCount(status)
+	return response, false
+}
+
+func (worker *worker) recordCount(status int) {
+	if status >= 100 && status < 200 {
+		worker.httpResult.status1xxCount++
+	} else if status >= 200 && status < 300 {
+		worker.httpResult.status2xxCount++
+	} else if status >= 300 && status < 400 {
+		worker.httpResult.status3xxCount++
+	} else if status >= 400 && status < 500 {
+		worker.httpResult.status4xxCount++
+	} else if status >= 500 && status < 600 {
+		worker.httpResult.status5xxCount++
+	}
+}
+
+// checkResponse runs the hooks and checks the expectation on a response, returning true if it failed either
+func (worker *worker) checkResponse(expectation *responseExpectation, request *OutgoingRequest, response *Response) bool {
+	failed := false
+	for _, hook := range worker.hooks {
+		if err := hook.AfterResponse(request, response); err != nil {
+			failed = true
+		}
+	}
+	if expectation != nil && !expectation.matches(response) {
+		failed = true
+	}
+	if worker.script != nil && worker.script.script.checkResponse != nil && worker.script.checkResponse(request, response, worker.requestNumber) {
+		failed = true
+	}
+	if failed {
+		worker.httpResult.expectationFailures++
+		if response.StatusCode >= 400 && response.StatusCode < 600 {
+			worker.httpResult.errorExpectations++
+		}
+	}
+	return failed
+}
+
+func (worker *worker) performRequestWithStats(request *OutgoingRequest, timings chan int) (*Response, bool) {
+	timeNow := time.Now().UnixNano()
+	response, err := worker.do(request)
+	if err != nil {
+		worker.recordError(err)
+		if isTimeout(err) && !worker.stopped() {
+			// The time waited is only a lower bound of the response time, so it is kept out of the response times
+			worker.httpResult.censoredTimes = append(worker.httpResult.censoredTimes, int((time.Now().UnixNano()-timeNow)/1000000))
+		}
+		return nil, true
+	}
+	timeAfter := time.Now().UnixNano()
+
+	i := int(timeAfter - timeNow)
+	// Record the timing into a channel
+	timings <- i
+
+	status := response.StatusCode
+	worker.recordCount(status)
+
+	return response, false
+}
+
+func (worker *worker) nextRequest(requests []preLoadedRequest, selector requestSelector) (preLoadedRequest, bool) {
+	if len(worker.httpResult.requestCounts) != len(requests) {
+		worker.httpResult.requestCounts = make([]int, len(requests))
+	}
+	index, ok := selector.next()
+	if !ok {
+		return preLoadedRequest{}, false
+	}
+	worker.httpResult.requestCounts[index]++
+	return requests[index], true
+}
+
+// buildRequest returns the request to send, or false if it needs data which has run out or the script stopped.
+// A request whose template fails to render is counted as a template error and returned as nil, to be skipped.
+func (worker *worker) buildRequest(currentReq preLoadedRequest) (*OutgoingRequest, bool) {
+	worker.requestNumber++
+	if worker.script != nil && worker.script.script.nextRequest != nil {
+		var ok bool
+		if currentReq, ok = worker.script.nextRequest(currentReq, worker.requestNumber); !ok {
+			return nil, false
+		}
+	} else if currentReq.template != nil {
+		data, ok := worker.templateData()
+		if !ok {
+			return nil, false
+		}
+		var err error
+		if currentReq, err = currentReq.template.render(currentReq, data); err != nil {
+			worker.httpResult.templateErrorCount++
+			return nil, true
+		}
+	}
+
+	return newOutgoingRequest(currentReq), true
+}
+
+// newOutgoingRequest returns the request a worker hands to its hooks and transport
+func newOutgoingRequest(currentReq preLoadedRequest) *OutgoingRequest {
+	request := &OutgoingRequest{Method: currentReq.method, URL: currentReq.url, Body: currentReq.body, Headers: make(http.Header, len(currentReq.headers))}
+	for i := 0; i < len(currentReq.headers); i++ {
+		request.Headers.Add(currentReq.headers[i][0], currentReq.headers[i][1])
+	}
+	return request
+}
+
+func (worker *worker) templateData() (map[string]interface{}, bool) {
+	data := map[string]interface{}{
+		"workerID":      worker.id,
+		"requestNumber": worker.requestNumber,
+	}
+	for key, value := range worker.virtualUser.variables {
+		data[key] = value
+	}
+	for _, feeder := range worker.dataFeeders {
+		row, ok := feeder.next(worker.id)
+		if !ok {
+			return nil, false
+		}
+		for key, value := range row {
+			data[key] = value
+		}
+	}
+	return data, true
+}
+
+func (worker *worker) finish() {
+	worker.httpResults <- worker.httpResult
+	worker.done <- true
+}
+
+func (worker *worker) collectStatistics(timings chan int) {
+	close(timings)
+
+	first := true
+	sum, total := int64(0), 0
+
+	for timing := range timings {
+		//Nano to milli
+		timing = timing / 1000000
+		// The first request is associated with overhead
+		// in setting up the client so we ignore it's result
+		if first {
+			first = false
+			continue
+		}
+
+		if timing < worker.httpResult.minTime {
+			worker.httpResult.minTime = timing
+		} else if timing >= worker.httpResult.maxTime {
+			worker.httpResult.maxTime = timing
+		}
+
+		//save all response times to compute results later
+		worker.httpResult.responseTimes = append(worker.httpResult.responseTimes, timing)
+
+		sum += int64(timing)
+		total++
+	}
+
+	worker.httpResult.timeSum = sum
+	worker.httpResult.totalSuccess = total
+}
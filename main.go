@@ -0,0 +1,215 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/americanexpress/baton/baton"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+var (
+	body               = flag.String("b", "", "Body (use instead of -f)")
+	caFile             = flag.String("cacert", "", "PEM bundle of the certificate authorities to trust instead of the system ones")
+	clientCert         = flag.String("cert", "", "Client certificate, as a PEM file or a PKCS#12 bundle (.p12 or .pfx)")
+	clientCertPassword = flag.String("cert-password", "", "Password of a PKCS#12 client certificate")
+	clientKey          = flag.String("key", "", "Key of the client certificate, as a PEM file")
+	concurrency        = flag.Int("c", 1, "Number of concurrent requests")
+	dataFilePath       = flag.String("f", "", "File path to file to be used as the body (use instead of -b)")
+	dataFiles          = flag.String("data", "", "Comma separated CSV or JSON files whose rows provide variables to templates")
+	dataMode           = flag.String("data-mode", "sequential", "How rows of the data files are used (sequential, random, unique, vu)")
+	dialTimeout        = flag.Duration("dial-timeout", 0, "Time to wait for a connection to be established, e.g. 3s")
+	disableKeepAlive   = flag.Bool("no-keep-alive", false, "Close the connection after every request")
+	duration           = flag.Int("t", 0, "Duration of testing in seconds (use instead of -r)")
+	harContentTypes    = flag.String("har-content-type", "", "Only load HAR entries whose response has one of these comma separated content types")
+	harDomains         = flag.String("har-domain", "", "Only load HAR entries for these comma separated domains (and their subdomains)")
+	http2              = flag.Bool("http2", false, "Send requests over HTTP/2, with TLS for https URLs and with prior knowledge (h2c) for http ones")
+	http2Conns         = flag.Int("http2-conns", 1, "Number of HTTP/2 connections the virtual users are spread over, with -http2")
+	http2Streams       = flag.Int("http2-streams", 0, "Most concurrent streams per HTTP/2 connection, with -http2 (default as many as the server allows)")
+	idleTimeout        = flag.Duration("idle-timeout", 0, "Time after which idle connections are closed (default 10s)")
+	ignoreTLS          = flag.Bool("i", false, "Ignore TLS/SSL certificate validation ")
+	keepCookies        = flag.Bool("cookies", false, "Keep the cookies set by responses, separately for each virtual user")
+	keepTiming         = flag.Bool("keep-timing", true, "Keep the recorded gaps between the requests of access logs and HAR files, in file order unless -s random or loop is given")
+	logPattern         = flag.String("log-pattern", "", "Regular expression with named groups (time and request, or method and path) used to parse access logs")
+	logTarget          = flag.String("log-target", "", "Base URL to replay the requests of an access log against")
+	maxConnRequests    = flag.Int("max-conn-requests", 0, "Close connections after this many requests, giving each virtual user its own connection")
+	maxConnsPerHost    = flag.Int("max-conns", 0, "Maximum number of connections open to a host (default 512)")
+	method             = flag.String("m", "GET", "HTTP Method (GET,POST,PUT,DELETE)")
+	numberOfRequests   = flag.Int("r", 0, "Number of requests (use instead of -t), 1 by default or the whole file once in sequential or partition order or when replaying recorded timing")
+	openAPIExcludeTags = flag.String("openapi-exclude-tags", "", "Skip OpenAPI operations with any of these comma separated tags")
+	openAPIServer      = flag.String("openapi-server", "", "Base URL replacing the scheme and host of the first server in the document, whose path is kept after its own")
+	openAPITags        = flag.String("openapi-tags", "", "Only load OpenAPI operations with any of these comma separated tags")
+	pacingInterval     = flag.Duration("pacing", 0, "Target time between the start of two iterations of a virtual user, e.g. 2s")
+	pipeline           = flag.Int("pipeline", 0, "Pipeline up to this many requests over each connection (-c should not exceed it times -pipeline-conns)")
+	pipelineConns      = flag.Int("pipeline-conns", 1, "Number of connections requests are pipelined over, with -pipeline")
+	postmanEnvironment = flag.String("postman-env", "", "Postman environment file used to resolve the variables of a collection")
+	readTimeout        = flag.Duration("read-timeout", 0, "Time to wait for data when reading a response")
+	replaySpeed        = flag.Float64("speed", 1, "Speed factor applied to the recorded timing of access logs and HAR files")
+	requestsFromFile   = flag.String("z", "", "Read requests from a file")
+	requestsFormat     = flag.String("format", "", "Format of the requests file (csv, jsonl, har, curl, openapi, postman, accesslog), detected from the file extension if not set")
+	requestOrder       = flag.String("s", "", "Order in which requests read from a file are sent (random, sequential, loop, partition), random by default or sequential when keeping the recorded timing")
+	scenarioFile       = flag.String("scenario", "", "Run the steps of a YAML or JSON scenario file for every request (use instead of -u or -z)")
+	scriptFile         = flag.String("script", "", "Starlark script generating the requests to send (instead of -u), checking the responses or both")
+	suppressOutput     = flag.Bool("o", false, "Suppress output, no results will be printed to stdout")
+	templateRequests   = flag.Bool("template", false, "Evaluate the template expressions of the requests read with -z (those of -u, -b, -f and scenarios always are)")
+	testPlanFile       = flag.String("plan", "", "YAML or JSON test plan file, whose values are overridden by the flags given")
+	thinkTimeSpec      = flag.String("think", "", "Think time after each request, e.g. 500ms, uniform:1s,3s, normal:2s,500ms or exponential:2s")
+	timeout            = flag.Duration("timeout", 0, "Time to wait for the response to a request, after which it counts as a timeout")
+	tlsCipherSuites    = flag.String("tls-ciphers", "", "Comma separated cipher suites offered for TLS 1.2 and below")
+	tlsHandshake       = flag.Bool("tls-handshake", false, "Open a new connection for every request and report the TLS handshakes")
+	tlsMaxVersion      = flag.String("tls-max", "", "Maximum TLS version (1.0, 1.1, 1.2, 1.3)")
+	tlsMinVersion      = flag.String("tls-min", "", "Minimum TLS version (1.0, 1.1, 1.2, 1.3)")
+	tlsResume          = flag.Bool("tls-resume", false, "Resume TLS sessions with session tickets (not session IDs, which Go does not support), with -tls-handshake")
+	tlsServerName      = flag.String("tls-server-name", "", "Server name sent with SNI and checked against the certificate of the server")
+	unixSocket         = flag.String("unix-socket", "", "Connect to this unix domain socket instead of the host of the URL, which is still sent as the Host header")
+	url                = flag.String("u", "", "URL to run against (unix:///path/to/app.sock:/path for a unix domain socket)")
+	vuConnections      = flag.Bool("vu-connections", false, "Give each virtual user a connection of its own instead of sharing a pool")
+	wait               = flag.Int("w", 0, "Number of seconds to wait before running test")
+	writeTimeout       = flag.Duration("write-timeout", 0, "Time to wait when writing a request")
+)
+
+// headerList collects the values of a flag which can be repeated
+type headerList []string
+
+var requestHeaders headerList
+
+func (headers *headerList) String() string {
+	return strings.Join(*headers, ", ")
+}
+
+func (headers *headerList) Set(value string) error {
+	*headers = append(*headers, value)
+	return nil
+}
+
+func init() {
+	flag.Var(&requestHeaders, "header", "Header added to every request, as \"Name: value\" (can be repeated)")
+}
+
+func main() {
+	flag.Parse()
+
+	config := baton.Config{
+		URL:                *url,
+		Method:             *method,
+		Body:               *body,
+		BodyFile:           *dataFilePath,
+		Headers:            requestHeaders,
+		RequestsFile:       *requestsFromFile,
+		RequestsFormat:     *requestsFormat,
+		RequestOrder:       *requestOrder,
+		TemplateRequests:   *templateRequests,
+		IgnoreTiming:       !*keepTiming,
+		ReplaySpeed:        *replaySpeed,
+		HARDomains:         list(*harDomains),
+		HARContentTypes:    list(*harContentTypes),
+		OpenAPIServer:      *openAPIServer,
+		OpenAPITags:        list(*openAPITags),
+		OpenAPIExcludeTags: list(*openAPIExcludeTags),
+		PostmanEnvironment: *postmanEnvironment,
+		LogPattern:         *logPattern,
+		LogTarget:          *logTarget,
+		ScenarioFile:       *scenarioFile,
+		DataFiles:          list(*dataFiles),
+		DataMode:           *dataMode,
+		Script:             *scriptFile,
+		Concurrency:        *concurrency,
+		Requests:           *numberOfRequests,
+		Duration:           time.Duration(*duration) * time.Second,
+		Wait:               time.Duration(*wait) * time.Second,
+		ThinkTime:          *thinkTimeSpec,
+		Pacing:             *pacingInterval,
+		KeepCookies:        *keepCookies,
+		VUConnections:      *vuConnections,
+		Quiet:              *suppressOutput,
+		IgnoreTLS:          *ignoreTLS,
+		ClientCert:         *clientCert,
+		ClientKey:          *clientKey,
+		ClientCertPassword: *clientCertPassword,
+		CAFile:             *caFile,
+		TLSServerName:      *tlsServerName,
+		TLSMinVersion:      *tlsMinVersion,
+		TLSMaxVersion:      *tlsMaxVersion,
+		TLSCipherSuites:    list(*tlsCipherSuites),
+		TLSHandshake:       *tlsHandshake,
+		TLSResume:          *tlsResume,
+		RequestTimeout:     *timeout,
+		DialTimeout:        *dialTimeout,
+		ReadTimeout:        *readTimeout,
+		WriteTimeout:       *writeTimeout,
+		IdleTimeout:        *idleTimeout,
+		DisableKeepAlive:   *disableKeepAlive,
+		MaxConnsPerHost:    *maxConnsPerHost,
+		MaxConnRequests:    *maxConnRequests,
+		Pipeline:           *pipeline,
+		PipelineConns:      *pipelineConns,
+		HTTP2:              *http2,
+		HTTP2Conns:         *http2Conns,
+		HTTP2Streams:       *http2Streams,
+		UnixSocket:         *unixSocket,
+	}
+
+	var plan *testPlan
+	if *testPlanFile != "" {
+		var err error
+		if plan, err = loadTestPlan(*testPlanFile); err != nil {
+			log.Fatalf("Failed to load test plan from file: %s: %v", *testPlanFile, err)
+		}
+		setFlags := make(map[string]bool)
+		flag.Visit(func(f *flag.Flag) {
+			setFlags[f.Name] = true
+		})
+		config = plan.apply(config, setFlags)
+	}
+	config.Sinks = []baton.ResultSink{baton.NewTextSink(os.Stdout)}
+
+	// Interrupting the run still prints the results of the requests sent so far, and interrupting it again exits
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	report, err := baton.Run(ctx, config)
+	if err != nil && err != context.Canceled {
+		log.Fatalf("Run failed: %v", err)
+	}
+
+	if plan != nil {
+		if violations := plan.Thresholds.check(report); len(violations) > 0 {
+			for _, violation := range violations {
+				fmt.Fprintln(os.Stderr, "Threshold crossed: "+violation)
+			}
+			os.Exit(1)
+		}
+	}
+}
+
+// list splits a comma separated flag into its values
+func list(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
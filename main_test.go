@@ -0,0 +1,151 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package main
+
+import (
+	"github.com/americanexpress/baton/baton"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThatTestPlanIsApplied(t *testing.T) {
+	fileContents := `version: 1
+target:
+  url: http://localhost:${BATON_TEST_PORT}/plan
+  method: POST
+  body: ${BATON_TEST_BODY:-planned}
+headers:
+  X-Plan: "${BATON_TEST_PORT}"
+load:
+  concurrency: 2
+  requests: 10
+  pacing: 10ms
+requests:
+  data: [users.csv]
+thresholds:
+  maxErrorRate: 1
+  minRequestsPerSecond: 1000
+tls:
+  cert: certs/client.p12
+  minVersion: "1.2"
+`
+	dir, err := ioutil.TempDir("", "baton")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fileDir := filepath.Join(dir, "plan.yaml")
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+
+	if _, err := loadTestPlan(fileDir); err == nil {
+		t.Errorf("Expected an error for an environment variable which is not set")
+	}
+	os.Setenv("BATON_TEST_PORT", "8888")
+	defer os.Unsetenv("BATON_TEST_PORT")
+
+	plan, err := loadTestPlan(fileDir)
+	if err != nil {
+		t.Fatalf("Failed to load test plan: %v", err)
+	}
+	config := plan.apply(baton.Config{Concurrency: 1}, map[string]bool{"c": true})
+	if config.URL != "http://localhost:8888/plan" || config.Method != "POST" || config.Body != "planned" {
+		t.Errorf("Expected the target of the plan to apply, got %s %s %s", config.Method, config.URL, config.Body)
+	}
+	if config.Concurrency != 1 || config.Requests != 10 || config.Pacing != 10*time.Millisecond {
+		t.Errorf("Expected the load of the plan to apply, except for the flags given, got %+v", config)
+	}
+	if len(config.Headers) != 1 || config.Headers[0] != "X-Plan: 8888" {
+		t.Errorf("Expected the headers of the plan to apply, got %v", config.Headers)
+	}
+	if len(config.DataFiles) != 1 || config.DataFiles[0] != filepath.Join(dir, "users.csv") {
+		t.Errorf("Expected data files to be relative to the plan, got %v", config.DataFiles)
+	}
+	if config.ClientCert != filepath.Join(dir, "certs", "client.p12") || config.TLSMinVersion != "1.2" {
+		t.Errorf("Expected the TLS options of the plan to apply, got %s %s", config.ClientCert, config.TLSMinVersion)
+	}
+
+	report := baton.Report{TotalRequests: 100, RequestsPerSecond: 500, Status2xx: 99, Status5xx: 1, FailedRequests: 1}
+	if violations := plan.Thresholds.check(report); len(violations) != 1 {
+		t.Errorf("Expected only the requests per second threshold to be crossed, got %v", violations)
+	}
+	report.Status5xx, report.Status2xx, report.FailedRequests = 2, 98, 2
+	if violations := plan.Thresholds.check(report); len(violations) != 2 {
+		t.Errorf("Expected the error rate threshold to be crossed too, got %v", violations)
+	}
+}
+
+func TestThatZeroThresholdsAreEnforced(t *testing.T) {
+	fileDir := filepath.Join(os.TempDir(), "baton-thresholds.yaml")
+	fileContents := "version: 1\nthresholds:\n  maxErrorRate: 0\n  maxResponseTime: 2s\n"
+	if ioutil.WriteFile(fileDir, []byte(fileContents), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	plan, err := loadTestPlan(fileDir)
+	if err != nil {
+		t.Fatalf("Failed to load test plan: %v", err)
+	}
+	if plan.Thresholds.MaxResponseTime == nil || *plan.Thresholds.MaxResponseTime != 2*time.Second {
+		t.Errorf("Expected the max response time to be read, got %v", plan.Thresholds.MaxResponseTime)
+	}
+	report := baton.Report{TotalRequests: 100, Status2xx: 100}
+	if violations := plan.Thresholds.check(report); len(violations) != 0 {
+		t.Errorf("Expected no threshold to be crossed without errors, got %v", violations)
+	}
+	report.Status2xx, report.ConnectionErrors, report.FailedRequests = 99, 1, 1
+	if violations := plan.Thresholds.check(report); len(violations) != 1 {
+		t.Errorf("Expected a single error to cross a maximum error rate of 0, got %v", violations)
+	}
+}
+
+func TestThatResponseTimeThresholdsFailWhenEveryRequestTimedOut(t *testing.T) {
+	maxTime, maxAverage := 2*time.Second, time.Second
+	thresholds := planThresholds{MaxResponseTime: &maxTime, MaxAverageTime: &maxAverage}
+
+	report := baton.Report{TotalRequests: 10, Timeouts: 10, FailedRequests: 10, HasResponseTimes: true, CensoredResponses: 10,
+		MinResponseTime: 100 * time.Millisecond, MaxResponseTime: 100 * time.Millisecond, AverageResponseTime: 100 * time.Millisecond}
+	if violations := thresholds.check(report); len(violations) != 2 {
+		t.Errorf("Expected the response time thresholds to be crossed when every request timed out, got %v", violations)
+	}
+	report.MeasuredResponses, report.CensoredResponses = 5, 5
+	if violations := thresholds.check(report); len(violations) != 0 {
+		t.Errorf("Expected lower bounds within the limits not to cross them, got %v", violations)
+	}
+	report.MaxResponseTime = 3 * time.Second
+	if violations := thresholds.check(report); len(violations) != 1 || !strings.Contains(violations[0], ">= 3s") {
+		t.Errorf("Expected a lower bound above the max response time to cross it, got %v", violations)
+	}
+}
+
+func TestThatTestPlanVersionIsChecked(t *testing.T) {
+	fileDir := filepath.Join(os.TempDir(), "baton-plan.json")
+	if ioutil.WriteFile(fileDir, []byte(`{"version": 2, "load": {"concurrency": 2}}`), 0644) != nil {
+		t.Errorf("Failed to write a required test case file. Check the directory permissions.")
+	}
+	defer os.Remove(fileDir)
+
+	if _, err := loadTestPlan(fileDir); err == nil {
+		t.Errorf("Expected an error for an unsupported version")
+	}
+}
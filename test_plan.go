@@ -0,0 +1,397 @@
+/*
+ * Copyright 2018 American Express
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ * http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express
+ * or implied. See the License for the specific language governing
+ * permissions and limitations under the License.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/americanexpress/baton/baton"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const testPlanVersion = 1
+
+// environmentVariable matches ${NAME} and ${NAME:-default} in a test plan
+var environmentVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// testPlan is a YAML or JSON file holding the configuration of a run
+type testPlan struct {
+	Version    int               `yaml:"version"`
+	Target     planTarget        `yaml:"target"`
+	Requests   planRequests      `yaml:"requests"`
+	Load       planLoad          `yaml:"load"`
+	Thresholds planThresholds    `yaml:"thresholds"`
+	Output     planOutput        `yaml:"output"`
+	TLS        planTLS           `yaml:"tls"`
+	Headers    map[string]string `yaml:"headers"`
+
+	dir string // Relative paths in the plan are resolved against its directory
+}
+
+type planTarget struct {
+	URL        string `yaml:"url"`
+	Method     string `yaml:"method"`
+	Body       string `yaml:"body"`
+	BodyFile   string `yaml:"bodyFile"`
+	UnixSocket string `yaml:"unixSocket"`
+}
+
+type planRequests struct {
+	File               string   `yaml:"file"`
+	Format             string   `yaml:"format"`
+	Order              string   `yaml:"order"`
+	Template           bool     `yaml:"template"`
+	Scenario           string   `yaml:"scenario"`
+	Script             string   `yaml:"script"`
+	Data               []string `yaml:"data"`
+	DataMode           string   `yaml:"dataMode"`
+	KeepTiming         *bool    `yaml:"keepTiming"`
+	Speed              float64  `yaml:"speed"`
+	HARDomains         []string `yaml:"harDomains"`
+	HARContentTypes    []string `yaml:"harContentTypes"`
+	OpenAPIServer      string   `yaml:"openAPIServer"`
+	OpenAPITags        []string `yaml:"openAPITags"`
+	OpenAPIExcludeTags []string `yaml:"openAPIExcludeTags"`
+	PostmanEnvironment string   `yaml:"postmanEnvironment"`
+	LogPattern         string   `yaml:"logPattern"`
+	LogTarget          string   `yaml:"logTarget"`
+}
+
+type planLoad struct {
+	Concurrency     int           `yaml:"concurrency"`
+	Requests        int           `yaml:"requests"`
+	Duration        time.Duration `yaml:"duration"`
+	Wait            time.Duration `yaml:"wait"`
+	Think           string        `yaml:"think"`
+	Pacing          time.Duration `yaml:"pacing"`
+	Cookies         bool          `yaml:"cookies"`
+	VUConnections   bool          `yaml:"vuConnections"`
+	NoKeepAlive     bool          `yaml:"noKeepAlive"`
+	MaxConns        int           `yaml:"maxConns"`
+	MaxConnRequests int           `yaml:"maxConnRequests"`
+	Pipeline        int           `yaml:"pipeline"`
+	PipelineConns   int           `yaml:"pipelineConns"`
+	HTTP2           bool          `yaml:"http2"`
+	HTTP2Conns      int           `yaml:"http2Conns"`
+	HTTP2Streams    int           `yaml:"http2Streams"`
+}
+
+// planThresholds are the limits a run has to stay within to pass, nil when not set so that 0 can be a limit too
+type planThresholds struct {
+	MaxErrorRate         *float64       `yaml:"maxErrorRate"` // Percentage of connection errors, timeouts, template errors, 4xx, 5xx and failed expectations
+	MaxAverageTime       *time.Duration `yaml:"maxAverageTime"`
+	MaxResponseTime      *time.Duration `yaml:"maxResponseTime"`
+	MinRequestsPerSecond *int           `yaml:"minRequestsPerSecond"`
+}
+
+type planOutput struct {
+	Quiet bool `yaml:"quiet"`
+}
+
+type planTLS struct {
+	Insecure     bool     `yaml:"insecure"`
+	Cert         string   `yaml:"cert"`
+	Key          string   `yaml:"key"`
+	CertPassword string   `yaml:"certPassword"`
+	CA           string   `yaml:"ca"`
+	ServerName   string   `yaml:"serverName"`
+	MinVersion   string   `yaml:"minVersion"`
+	MaxVersion   string   `yaml:"maxVersion"`
+	CipherSuites []string `yaml:"cipherSuites"`
+	Handshake    bool     `yaml:"handshake"`
+	Resume       bool     `yaml:"resume"`
+}
+
+// interpolateEnvironment replaces the environment variables referenced in a test plan by their values
+func interpolateEnvironment(contents string) (string, error) {
+	var missing []string
+	interpolated := environmentVariable.ReplaceAllStringFunc(contents, func(reference string) string {
+		match := environmentVariable.FindStringSubmatch(reference)
+		if value, ok := os.LookupEnv(match[1]); ok {
+			return value
+		}
+		if strings.Contains(reference, ":-") {
+			return match[2]
+		}
+		missing = append(missing, match[1])
+		return reference
+	})
+	if len(missing) > 0 {
+		return "", errors.New("environment variables not set: " + strings.Join(missing, ", "))
+	}
+	return interpolated, nil
+}
+
+func loadTestPlan(filename string) (*testPlan, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	interpolated, err := interpolateEnvironment(string(contents))
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON being a subset of YAML, both are decoded the same way
+	plan := &testPlan{dir: filepath.Dir(filename)}
+	if err := yaml.UnmarshalStrict([]byte(interpolated), plan); err != nil {
+		return nil, err
+	}
+	if plan.Version != testPlanVersion {
+		return nil, fmt.Errorf("unsupported test plan version %d, expected %d", plan.Version, testPlanVersion)
+	}
+	return plan, nil
+}
+
+func (plan *testPlan) path(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(plan.dir, path)
+}
+
+func (plan *testPlan) paths(paths []string) []string {
+	resolved := make([]string, len(paths))
+	for i, path := range paths {
+		resolved[i] = plan.path(path)
+	}
+	return resolved
+}
+
+func (plan *testPlan) headers() []string {
+	var headers []string
+	for name, value := range plan.Headers {
+		headers = append(headers, name+": "+value)
+	}
+	sort.Strings(headers)
+	return headers
+}
+
+// apply sets the values of the plan on a configuration, except for the flags given on the command line
+func (plan *testPlan) apply(config baton.Config, setFlags map[string]bool) baton.Config {
+	unset := func(flagName string) bool {
+		return !setFlags[flagName]
+	}
+
+	target, requests, load := plan.Target, plan.Requests, plan.Load
+	if target.URL != "" && unset("u") {
+		config.URL = target.URL
+	}
+	if target.Method != "" && unset("m") {
+		config.Method = target.Method
+	}
+	if target.Body != "" && unset("b") {
+		config.Body = target.Body
+	}
+	if target.BodyFile != "" && unset("f") {
+		config.BodyFile = plan.path(target.BodyFile)
+	}
+	if target.UnixSocket != "" && unset("unix-socket") {
+		config.UnixSocket = plan.path(target.UnixSocket)
+	}
+	if len(plan.Headers) > 0 && unset("header") {
+		config.Headers = plan.headers()
+	}
+
+	if requests.File != "" && unset("z") {
+		config.RequestsFile = plan.path(requests.File)
+	}
+	if requests.Format != "" && unset("format") {
+		config.RequestsFormat = requests.Format
+	}
+	if requests.Order != "" && unset("s") {
+		config.RequestOrder = requests.Order
+	}
+	if requests.Template && unset("template") {
+		config.TemplateRequests = true
+	}
+	if requests.Scenario != "" && unset("scenario") {
+		config.ScenarioFile = plan.path(requests.Scenario)
+	}
+	if requests.Script != "" && unset("script") {
+		config.Script = plan.path(requests.Script)
+	}
+	if len(requests.Data) > 0 && unset("data") {
+		config.DataFiles = plan.paths(requests.Data)
+	}
+	if requests.DataMode != "" && unset("data-mode") {
+		config.DataMode = requests.DataMode
+	}
+	if requests.KeepTiming != nil && unset("keep-timing") {
+		config.IgnoreTiming = !*requests.KeepTiming
+	}
+	if requests.Speed != 0 && unset("speed") {
+		config.ReplaySpeed = requests.Speed
+	}
+	if len(requests.HARDomains) > 0 && unset("har-domain") {
+		config.HARDomains = requests.HARDomains
+	}
+	if len(requests.HARContentTypes) > 0 && unset("har-content-type") {
+		config.HARContentTypes = requests.HARContentTypes
+	}
+	if requests.OpenAPIServer != "" && unset("openapi-server") {
+		config.OpenAPIServer = requests.OpenAPIServer
+	}
+	if len(requests.OpenAPITags) > 0 && unset("openapi-tags") {
+		config.OpenAPITags = requests.OpenAPITags
+	}
+	if len(requests.OpenAPIExcludeTags) > 0 && unset("openapi-exclude-tags") {
+		config.OpenAPIExcludeTags = requests.OpenAPIExcludeTags
+	}
+	if requests.PostmanEnvironment != "" && unset("postman-env") {
+		config.PostmanEnvironment = plan.path(requests.PostmanEnvironment)
+	}
+	if requests.LogPattern != "" && unset("log-pattern") {
+		config.LogPattern = requests.LogPattern
+	}
+	if requests.LogTarget != "" && unset("log-target") {
+		config.LogTarget = requests.LogTarget
+	}
+
+	if load.Concurrency != 0 && unset("c") {
+		config.Concurrency = load.Concurrency
+	}
+	if load.Requests != 0 && unset("r") {
+		config.Requests = load.Requests
+	}
+	if load.Duration != 0 && unset("t") {
+		config.Duration = load.Duration
+	}
+	if load.Wait != 0 && unset("w") {
+		config.Wait = load.Wait
+	}
+	if load.Think != "" && unset("think") {
+		config.ThinkTime = load.Think
+	}
+	if load.Pacing != 0 && unset("pacing") {
+		config.Pacing = load.Pacing
+	}
+	if load.Cookies && unset("cookies") {
+		config.KeepCookies = true
+	}
+	if load.VUConnections && unset("vu-connections") {
+		config.VUConnections = true
+	}
+	if load.NoKeepAlive && unset("no-keep-alive") {
+		config.DisableKeepAlive = true
+	}
+	if load.MaxConns != 0 && unset("max-conns") {
+		config.MaxConnsPerHost = load.MaxConns
+	}
+	if load.MaxConnRequests != 0 && unset("max-conn-requests") {
+		config.MaxConnRequests = load.MaxConnRequests
+	}
+	if load.Pipeline != 0 && unset("pipeline") {
+		config.Pipeline = load.Pipeline
+	}
+	if load.PipelineConns != 0 && unset("pipeline-conns") {
+		config.PipelineConns = load.PipelineConns
+	}
+	if load.HTTP2 && unset("http2") {
+		config.HTTP2 = true
+	}
+	if load.HTTP2Conns != 0 && unset("http2-conns") {
+		config.HTTP2Conns = load.HTTP2Conns
+	}
+	if load.HTTP2Streams != 0 && unset("http2-streams") {
+		config.HTTP2Streams = load.HTTP2Streams
+	}
+
+	if plan.Output.Quiet && unset("o") {
+		config.Quiet = true
+	}
+	tls := plan.TLS
+	if tls.Insecure && unset("i") {
+		config.IgnoreTLS = true
+	}
+	if tls.Cert != "" && unset("cert") {
+		config.ClientCert = plan.path(tls.Cert)
+	}
+	if tls.Key != "" && unset("key") {
+		config.ClientKey = plan.path(tls.Key)
+	}
+	if tls.CertPassword != "" && unset("cert-password") {
+		config.ClientCertPassword = tls.CertPassword
+	}
+	if tls.CA != "" && unset("cacert") {
+		config.CAFile = plan.path(tls.CA)
+	}
+	if tls.ServerName != "" && unset("tls-server-name") {
+		config.TLSServerName = tls.ServerName
+	}
+	if tls.MinVersion != "" && unset("tls-min") {
+		config.TLSMinVersion = tls.MinVersion
+	}
+	if tls.MaxVersion != "" && unset("tls-max") {
+		config.TLSMaxVersion = tls.MaxVersion
+	}
+	if len(tls.CipherSuites) > 0 && unset("tls-ciphers") {
+		config.TLSCipherSuites = tls.CipherSuites
+	}
+	if tls.Handshake && unset("tls-handshake") {
+		config.TLSHandshake = true
+	}
+	if tls.Resume && unset("tls-resume") {
+		config.TLSResume = true
+	}
+
+	return config
+}
+
+// check returns a description of every threshold the result of a run has crossed
+func (thresholds planThresholds) check(report baton.Report) []string {
+	var violations []string
+
+	if thresholds.MaxErrorRate != nil && report.TotalRequests > 0 {
+		if rate := 100 * float64(report.FailedRequests) / float64(report.TotalRequests); rate > *thresholds.MaxErrorRate {
+			violations = append(violations, fmt.Sprintf("error rate %.2f%% is above %.2f%%", rate, *thresholds.MaxErrorRate))
+		}
+	}
+	// The response times of the requests which timed out are only known to be above the time waited, so a lower bound
+	// above the limit crosses it, and nothing can be said to be within the limit when every request timed out
+	onlyTimeouts := report.MeasuredResponses == 0 && report.CensoredResponses > 0
+	bound := ""
+	if report.CensoredResponses > 0 {
+		bound = ">= "
+	}
+	if thresholds.MaxAverageTime != nil && report.HasResponseTimes {
+		if onlyTimeouts {
+			violations = append(violations, "average response time is unknown, as every request timed out")
+		} else if report.AverageResponseTime > *thresholds.MaxAverageTime {
+			violations = append(violations, fmt.Sprintf("average response time %s%s is above %s", bound, report.AverageResponseTime, *thresholds.MaxAverageTime))
+		}
+	}
+	if thresholds.MaxResponseTime != nil && report.HasResponseTimes {
+		if onlyTimeouts {
+			violations = append(violations, "max response time is unknown, as every request timed out")
+		} else if report.MaxResponseTime > *thresholds.MaxResponseTime {
+			violations = append(violations, fmt.Sprintf("max response time %s%s is above %s", bound, report.MaxResponseTime, *thresholds.MaxResponseTime))
+		}
+	}
+	if thresholds.MinRequestsPerSecond != nil && report.RequestsPerSecond < *thresholds.MinRequestsPerSecond {
+		violations = append(violations, fmt.Sprintf("%d requests per second is below %d", report.RequestsPerSecond, *thresholds.MinRequestsPerSecond))
+	}
+
+	return violations
+}